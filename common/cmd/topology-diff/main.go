@@ -0,0 +1,326 @@
+// Command topology-diff compares topology.Default with the exchanges, queues
+// and bindings of a running broker, read through the management API. It
+// prints one line per difference and exits with status 1 when there is any,
+// so it can gate a deploy:
+//
+//	go run ./cmd/topology-diff -url http://localhost:15672 -user guest -password guest
+//
+// A queue whose type or arguments differ cannot be redeclared in place, and
+// the services fail to start with PRECONDITION_FAILED until it is replaced.
+// With -migrate such queues are deleted and declared again, with their
+// bindings, as the topology wants them. Only empty queues are replaced, so
+// a broker still holding classic queues is migrated with:
+//
+//  1. stop product-service and the other publishers, and let the consumers
+//     of the old services empty the queues;
+//  2. go run ./cmd/topology-diff -migrate -url ... -user ... -password ...
+//  3. deploy the new services.
+//
+// Queues that still hold messages are reported and left alone.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"common/topology"
+)
+
+type brokerExchange struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Durable bool   `json:"durable"`
+}
+
+type brokerQueue struct {
+	Name      string                 `json:"name"`
+	Type      string                 `json:"type"`
+	Durable   bool                   `json:"durable"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Messages  int                    `json:"messages"`
+}
+
+type brokerBinding struct {
+	Source          string `json:"source"`
+	Destination     string `json:"destination"`
+	DestinationType string `json:"destination_type"`
+	RoutingKey      string `json:"routing_key"`
+}
+
+type client struct {
+	base     string
+	vhost    string
+	user     string
+	password string
+	http     *http.Client
+}
+
+func (c *client) get(resource string, v interface{}) error {
+	return c.do(http.MethodGet, resource+"/"+url.PathEscape(c.vhost), nil, v)
+}
+
+// do calls the management API at /api/path, sending body and decoding the
+// response into v when they are not nil.
+func (c *client) do(method, path string, body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+"/api/"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.user, c.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s", method, req.URL, resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// replaceQueue deletes q, which has to be empty, and declares it again with
+// its bindings as t wants it.
+func (c *client) replaceQueue(t topology.Topology, q topology.Queue) error {
+	path := "queues/" + url.PathEscape(c.vhost) + "/" + url.PathEscape(q.Name)
+	if err := c.do(http.MethodDelete, path+"?if-empty=true", nil, nil); err != nil {
+		return err
+	}
+	declare := map[string]interface{}{"durable": true, "auto_delete": false, "arguments": q.Args()}
+	if err := c.do(http.MethodPut, path, declare, nil); err != nil {
+		return err
+	}
+	for _, b := range t.Bindings {
+		if b.ToExchange || b.Destination != q.Name {
+			continue
+		}
+		bindPath := "bindings/" + url.PathEscape(c.vhost) + "/e/" + url.PathEscape(b.Source) + "/q/" + url.PathEscape(q.Name)
+		if err := c.do(http.MethodPost, bindPath, map[string]string{"routing_key": b.Key}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mismatched returns the declared queues that exist on the broker with
+// another type, durability or arguments.
+func mismatched(t topology.Topology, queues []brokerQueue) []topology.Queue {
+	actual := make(map[string]brokerQueue)
+	for _, q := range queues {
+		actual[q.Name] = q
+	}
+	var stale []topology.Queue
+	for _, want := range t.Queues {
+		got, ok := actual[want.Name]
+		if !ok {
+			continue
+		}
+		if !got.Durable || len(diffArgs(want.Name, want.Args(), withType(got))) > 0 {
+			stale = append(stale, want)
+		}
+	}
+	return stale
+}
+
+// withType returns the arguments of q with its type, which queues declared
+// without x-queue-type still report.
+func withType(q brokerQueue) map[string]interface{} {
+	args := make(map[string]interface{}, len(q.Arguments)+1)
+	for name, value := range q.Arguments {
+		args[name] = value
+	}
+	if _, ok := args["x-queue-type"]; !ok && q.Type != "" {
+		args["x-queue-type"] = q.Type
+	}
+	return args
+}
+
+func main() {
+	base := flag.String("url", "http://localhost:15672", "management API base URL")
+	vhost := flag.String("vhost", "/", "virtual host")
+	user := flag.String("user", "guest", "management API user")
+	password := flag.String("password", "guest", "management API password")
+	migrate := flag.Bool("migrate", false, "replace empty queues whose type or arguments differ")
+	flag.Parse()
+
+	c := &client{
+		base:     *base,
+		vhost:    *vhost,
+		user:     *user,
+		password: *password,
+		http:     &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var exchanges []brokerExchange
+	var queues []brokerQueue
+	var bindings []brokerBinding
+	for resource, v := range map[string]interface{}{
+		"exchanges": &exchanges,
+		"queues":    &queues,
+		"bindings":  &bindings,
+	} {
+		if err := c.get(resource, v); err != nil {
+			fmt.Fprintf(os.Stderr, "topology-diff: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if *migrate {
+		messages := make(map[string]int)
+		for _, q := range queues {
+			messages[q.Name] = q.Messages
+		}
+		failed := false
+		for _, q := range mismatched(topology.Default, queues) {
+			if n := messages[q.Name]; n > 0 {
+				fmt.Printf("! queue %s holds %d messages; stop its publishers and let it drain first\n", q.Name, n)
+				failed = true
+				continue
+			}
+			if err := c.replaceQueue(topology.Default, q); err != nil {
+				fmt.Fprintf(os.Stderr, "topology-diff: migrate queue %s: %v\n", q.Name, err)
+				os.Exit(2)
+			}
+			fmt.Printf("migrated queue %s\n", q.Name)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		// Compare again against the migrated broker
+		for resource, v := range map[string]interface{}{"queues": &queues, "bindings": &bindings} {
+			if err := c.get(resource, v); err != nil {
+				fmt.Fprintf(os.Stderr, "topology-diff: %v\n", err)
+				os.Exit(2)
+			}
+		}
+	}
+
+	diffs := diff(topology.Default, exchanges, queues, bindings)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("broker matches the declared topology")
+}
+
+// diff lists how the broker differs from t. Entities t does not name, such
+// as the per-instance websocket queues, are ignored.
+func diff(t topology.Topology, exchanges []brokerExchange, queues []brokerQueue, bindings []brokerBinding) []string {
+	var diffs []string
+
+	actualExchanges := make(map[string]brokerExchange)
+	for _, e := range exchanges {
+		actualExchanges[e.Name] = e
+	}
+	declared := make(map[string]bool)
+	for _, want := range t.Exchanges {
+		declared[want.Name] = true
+		got, ok := actualExchanges[want.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("+ exchange %s (%s)", want.Name, want.Kind))
+		case got.Type != want.Kind:
+			diffs = append(diffs, fmt.Sprintf("~ exchange %s: type %s, want %s", want.Name, got.Type, want.Kind))
+		case !got.Durable:
+			diffs = append(diffs, fmt.Sprintf("~ exchange %s: not durable", want.Name))
+		}
+	}
+
+	actualQueues := make(map[string]brokerQueue)
+	for _, q := range queues {
+		actualQueues[q.Name] = q
+	}
+	for _, want := range t.Queues {
+		declared[want.Name] = true
+		got, ok := actualQueues[want.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("+ queue %s (%s)", want.Name, want.Type))
+			continue
+		}
+		if !got.Durable {
+			diffs = append(diffs, fmt.Sprintf("~ queue %s: not durable", want.Name))
+		}
+		diffs = append(diffs, diffArgs(want.Name, want.Args(), withType(got))...)
+	}
+
+	type bindingKey struct {
+		source, destination, key string
+		toExchange               bool
+	}
+	actualBindings := make(map[bindingKey]bool)
+	for _, b := range bindings {
+		actualBindings[bindingKey{b.Source, b.Destination, b.RoutingKey, b.DestinationType == "exchange"}] = true
+	}
+	wantBindings := make(map[bindingKey]bool)
+	for _, want := range t.Bindings {
+		k := bindingKey{want.Source, want.Destination, want.Key, want.ToExchange}
+		wantBindings[k] = true
+		if !actualBindings[k] {
+			diffs = append(diffs, fmt.Sprintf("+ binding %s -> %s with %q", want.Source, want.Destination, want.Key))
+		}
+	}
+	for _, b := range bindings {
+		k := bindingKey{b.Source, b.Destination, b.RoutingKey, b.DestinationType == "exchange"}
+		if declared[b.Source] && declared[b.Destination] && !wantBindings[k] {
+			diffs = append(diffs, fmt.Sprintf("- binding %s -> %s with %q", b.Source, b.Destination, b.RoutingKey))
+		}
+	}
+	return diffs
+}
+
+// diffArgs compares queue arguments by their JSON encoding, since the
+// management API returns every number as a float.
+func diffArgs(queue string, want map[string]interface{}, got map[string]interface{}) []string {
+	names := make(map[string]bool)
+	for name := range want {
+		names[name] = true
+	}
+	for name := range got {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, name := range sorted {
+		w, inWant := want[name]
+		g, inGot := got[name]
+		wantJSON, _ := json.Marshal(w)
+		gotJSON, _ := json.Marshal(g)
+		switch {
+		case !inGot:
+			diffs = append(diffs, fmt.Sprintf("~ queue %s: %s missing, want %s", queue, name, wantJSON))
+		case !inWant:
+			diffs = append(diffs, fmt.Sprintf("~ queue %s: %s is %s, want unset", queue, name, gotJSON))
+		case string(wantJSON) != string(gotJSON):
+			diffs = append(diffs, fmt.Sprintf("~ queue %s: %s is %s, want %s", queue, name, gotJSON, wantJSON))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"common/topology"
+)
+
+var testTopology = topology.Topology{
+	Exchanges: []topology.Exchange{{Name: "ex", Kind: "direct"}},
+	Queues:    []topology.Queue{{Name: "q", Type: topology.Quorum, MaxLength: 10}},
+	Bindings:  []topology.Binding{{Source: "ex", Key: "k", Destination: "q"}},
+}
+
+func TestDiff(t *testing.T) {
+	matching := []brokerQueue{{Name: "q", Type: "quorum", Durable: true, Arguments: map[string]interface{}{"x-queue-type": "quorum", "x-max-length": 10.0}}}
+	tests := []struct {
+		name      string
+		exchanges []brokerExchange
+		queues    []brokerQueue
+		bindings  []brokerBinding
+		want      []string
+	}{
+		{
+			name:      "matches",
+			exchanges: []brokerExchange{{Name: "ex", Type: "direct", Durable: true}},
+			queues:    matching,
+			bindings:  []brokerBinding{{Source: "ex", Destination: "q", DestinationType: "queue", RoutingKey: "k"}},
+		},
+		{
+			name: "missing",
+			want: []string{"+ exchange ex (direct)", "+ queue q (quorum)", `+ binding ex -> q with "k"`},
+		},
+		{
+			name:      "classic queue",
+			exchanges: []brokerExchange{{Name: "ex", Type: "direct", Durable: true}},
+			queues:    []brokerQueue{{Name: "q", Type: "classic", Durable: true}},
+			bindings:  []brokerBinding{{Source: "ex", Destination: "q", DestinationType: "queue", RoutingKey: "k"}},
+			want: []string{
+				"~ queue q: x-max-length missing, want 10",
+				`~ queue q: x-queue-type is "classic", want "quorum"`,
+			},
+		},
+		{
+			name:      "extra binding",
+			exchanges: []brokerExchange{{Name: "ex", Type: "topic", Durable: true}},
+			queues:    matching,
+			bindings: []brokerBinding{
+				{Source: "ex", Destination: "q", DestinationType: "queue", RoutingKey: "k"},
+				{Source: "ex", Destination: "q", DestinationType: "queue", RoutingKey: "old"},
+			},
+			want: []string{"~ exchange ex: type topic, want direct", `- binding ex -> q with "old"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diff(testTopology, tt.exchanges, tt.queues, tt.bindings)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMismatched(t *testing.T) {
+	tests := []struct {
+		name   string
+		queues []brokerQueue
+		want   []string
+	}{
+		{"absent", nil, nil},
+		{"matching", []brokerQueue{{Name: "q", Type: "quorum", Durable: true, Arguments: map[string]interface{}{"x-max-length": 10.0}}}, nil},
+		{"classic", []brokerQueue{{Name: "q", Type: "classic", Durable: true}}, []string{"q"}},
+		{"transient", []brokerQueue{{Name: "q", Type: "quorum", Arguments: map[string]interface{}{"x-max-length": 10.0}}}, []string{"q"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, q := range mismatched(testTopology, tt.queues) {
+				got = append(got, q.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mismatched = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceQueue(t *testing.T) {
+	var calls []string
+	var declared map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&declared)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := &client{base: server.URL, vhost: "/", http: &http.Client{Timeout: time.Second}}
+	if err := c.replaceQueue(testTopology, testTopology.Queues[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"DELETE /api/queues/%2F/q?if-empty=true",
+		"PUT /api/queues/%2F/q",
+		"POST /api/bindings/%2F/e/ex/q/q",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	args, _ := declared["arguments"].(map[string]interface{})
+	if args["x-queue-type"] != "quorum" || declared["durable"] != true {
+		t.Errorf("declared %v", declared)
+	}
+}
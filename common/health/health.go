@@ -0,0 +1,116 @@
+// Package health serves the liveness and readiness endpoints with a JSON
+// breakdown per dependency.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds how long a single dependency check may take.
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name     string
+	check    Check
+	liveness bool
+}
+
+// Checker runs the registered checks for /healthz and /readyz.
+type Checker struct {
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+// AddReadiness registers a check that only /readyz runs, such as a database
+// ping: the service is alive but cannot serve without it.
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.add(namedCheck{name: name, check: check})
+}
+
+// AddLiveness registers a check both endpoints run, such as a consumer
+// goroutine that only a restart brings back.
+func (c *Checker) AddLiveness(name string, check Check) {
+	c.add(namedCheck{name: name, check: check, liveness: true})
+}
+
+func (c *Checker) add(check namedCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+}
+
+type checkResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+type report struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// Healthz serves the liveness checks.
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	c.serve(w, r, true)
+}
+
+// Readyz serves every check.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	c.serve(w, r, false)
+}
+
+func (c *Checker) serve(w http.ResponseWriter, r *http.Request, livenessOnly bool) {
+	c.mu.Lock()
+	checks := make([]namedCheck, 0, len(c.checks))
+	for _, check := range c.checks {
+		if check.liveness || !livenessOnly {
+			checks = append(checks, check)
+		}
+	}
+	c.mu.Unlock()
+
+	// Run the checks concurrently so one slow dependency does not hold up
+	// the others
+	rep := report{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check namedCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.check(ctx)
+			result := checkResult{Status: "ok", Latency: time.Since(start).String()}
+			if err != nil {
+				result.Status, result.Error = "down", err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[check.name] = result
+			if err != nil {
+				rep.Status = "unavailable"
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if rep.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rep)
+}
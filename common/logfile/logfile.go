@@ -0,0 +1,127 @@
+// Package logfile provides an append-only log file that rotates itself once
+// it grows too large or too old.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer appends to a file and rotates it when a write would take it past
+// MaxSize bytes, or when it was opened more than MaxAge ago. Rotated files
+// are renamed with a timestamp suffix and only the newest MaxBackups kept.
+type Writer struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// Open opens or creates the log file at path. Zero limits disable the
+// matching rotation or pruning.
+func Open(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*Writer, error) {
+	w := &Writer{Path: path, MaxSize: maxSize, MaxAge: maxAge, MaxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = info.ModTime()
+	if w.size == 0 {
+		w.openedAt = time.Now()
+	}
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.size > 0 && ((w.MaxSize > 0 && w.size+int64(len(p)) > w.MaxSize) ||
+		(w.MaxAge > 0 && time.Since(w.openedAt) > w.MaxAge)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close flushes the current file to disk and closes it.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
+
+// rotate renames the current file out of the way and starts a new one.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	ext := filepath.Ext(w.Path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.Path, ext), time.Now().UTC().Format("20060102T150405.000"), ext)
+	if err := os.Rename(w.Path, backup); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// prune removes the oldest backups beyond MaxBackups.
+func (w *Writer) prune() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+	ext := filepath.Ext(w.Path)
+	backups, err := filepath.Glob(strings.TrimSuffix(w.Path, ext) + "-*" + ext)
+	if err != nil || len(backups) <= w.MaxBackups {
+		return
+	}
+	// Timestamps sort lexically in the order they were written.
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-w.MaxBackups] {
+		os.Remove(backup)
+	}
+}
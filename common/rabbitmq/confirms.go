@@ -0,0 +1,250 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// publishAttempts is how many times a publish is tried before its error
+	// is returned.
+	publishAttempts = 3
+	publishBackoff  = 200 * time.Millisecond
+	// confirmTimeout bounds the wait for the broker to confirm one attempt.
+	confirmTimeout = 5 * time.Second
+	// notifyBuffer is the capacity of the confirm and return channels, so the
+	// library's reader is not held up by the confirm loop.
+	notifyBuffer = 128
+)
+
+// ErrNacked is returned when the broker refuses to take a message.
+var ErrNacked = errors.New("rabbitmq: message nacked by broker")
+
+// ErrUnroutable is matched by the ReturnError of a mandatory message that
+// no queue is bound for.
+var ErrUnroutable = errors.New("rabbitmq: message unroutable")
+
+// ReturnError describes a mandatory message the broker returned.
+type ReturnError struct {
+	Exchange   string
+	RoutingKey string
+	Code       uint16
+	Text       string
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("rabbitmq: message to %s with routing key %q returned: %d %s", e.Exchange, e.RoutingKey, e.Code, e.Text)
+}
+
+func (e *ReturnError) Unwrap() error {
+	return ErrUnroutable
+}
+
+type pendingPublish struct {
+	messageID string
+	returned  *amqp091.Return
+	done      chan error
+}
+
+// tracker matches the confirmations and returns of a channel in confirm
+// mode to the publishes waiting for them.
+type tracker struct {
+	// publishMu keeps each sequence number with its publish. The confirm
+	// loop never takes it.
+	publishMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]*pendingPublish
+	byID    map[string]*pendingPublish
+	closed  bool
+}
+
+// track puts ch in confirm mode and starts matching its confirmations.
+func track(ch *amqp091.Channel) (*tracker, error) {
+	t := &tracker{
+		pending: make(map[uint64]*pendingPublish),
+		byID:    make(map[string]*pendingPublish),
+	}
+	confirms := ch.NotifyPublish(make(chan amqp091.Confirmation, notifyBuffer))
+	returns := ch.NotifyReturn(make(chan amqp091.Return, notifyBuffer))
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	go t.run(confirms, returns)
+	return t, nil
+}
+
+func (t *tracker) run(confirms <-chan amqp091.Confirmation, returns <-chan amqp091.Return) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			t.recordReturn(ret)
+
+		case confirm, ok := <-confirms:
+			if !ok {
+				t.fail()
+				return
+			}
+			// The broker sends the return of an unroutable message before
+			// its ack, and the library queues them in that order, so any
+			// return for this message is already buffered
+			for drained := false; !drained && returns != nil; {
+				select {
+				case ret, ok := <-returns:
+					if !ok {
+						returns = nil
+						continue
+					}
+					t.recordReturn(ret)
+				default:
+					drained = true
+				}
+			}
+
+			t.mu.Lock()
+			p := t.pending[confirm.DeliveryTag]
+			delete(t.pending, confirm.DeliveryTag)
+			if p != nil {
+				delete(t.byID, p.messageID)
+			}
+			t.mu.Unlock()
+
+			switch {
+			case p == nil:
+			case !confirm.Ack:
+				p.done <- ErrNacked
+			case p.returned != nil:
+				p.done <- &ReturnError{
+					Exchange:   p.returned.Exchange,
+					RoutingKey: p.returned.RoutingKey,
+					Code:       p.returned.ReplyCode,
+					Text:       p.returned.ReplyText,
+				}
+			default:
+				p.done <- nil
+			}
+		}
+	}
+}
+
+func (t *tracker) recordReturn(ret amqp091.Return) {
+	log.Printf("rabbitmq: message %s to %s with routing key %q returned: %d %s",
+		ret.MessageId, ret.Exchange, ret.RoutingKey, ret.ReplyCode, ret.ReplyText)
+	t.mu.Lock()
+	if p := t.byID[ret.MessageId]; p != nil {
+		p.returned = &ret
+	}
+	t.mu.Unlock()
+}
+
+// fail releases the publishes still waiting when the channel closes.
+func (t *tracker) fail() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for tag, p := range t.pending {
+		p.done <- ErrNotConnected
+		delete(t.pending, tag)
+	}
+	t.byID = make(map[string]*pendingPublish)
+}
+
+// publish sends msg on ch and waits for the broker to confirm it.
+func (t *tracker) publish(ctx context.Context, ch *amqp091.Channel, exchange, routingKey string, mandatory bool, msg amqp091.Publishing) error {
+	p := &pendingPublish{messageID: msg.MessageId, done: make(chan error, 1)}
+
+	// The publish is registered under mu but sent outside it, so the
+	// confirm loop, which the library may be waiting on, can always take mu
+	t.publishMu.Lock()
+	tag := ch.GetNextPublishSeqNo()
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		t.publishMu.Unlock()
+		return ErrNotConnected
+	}
+	t.pending[tag] = p
+	t.byID[p.messageID] = p
+	t.mu.Unlock()
+	err := ch.PublishWithContext(ctx, exchange, routingKey, mandatory, false, msg)
+	t.publishMu.Unlock()
+	if err != nil {
+		t.forget(tag, p)
+		return err
+	}
+
+	select {
+	case err := <-p.done:
+		return err
+	case <-ctx.Done():
+		t.forget(tag, p)
+		return ctx.Err()
+	}
+}
+
+// forget stops waiting for the confirmation of p.
+func (t *tracker) forget(tag uint64, p *pendingPublish) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending[tag] == p {
+		delete(t.pending, tag)
+		delete(t.byID, p.messageID)
+	}
+}
+
+// Publish publishes msg and waits for the broker to confirm it, retrying
+// with backoff while the manager reconnects or the broker nacks. Mandatory
+// messages no queue is bound for fail with a ReturnError and are not
+// retried. Messages without a MessageId get one so returns can be matched.
+func (m *Manager) Publish(ctx context.Context, exchange, routingKey string, mandatory bool, msg amqp091.Publishing) error {
+	if msg.MessageId == "" {
+		msg.MessageId = newMessageID()
+	}
+
+	backoff := publishBackoff
+	for attempt := 1; ; attempt++ {
+		err := m.publishOnce(ctx, exchange, routingKey, mandatory, msg)
+		if err == nil || errors.Is(err, ErrUnroutable) || ctx.Err() != nil || attempt == publishAttempts {
+			return err
+		}
+		log.Printf("rabbitmq: publish to %s with routing key %q failed, retrying in %s: %v", exchange, routingKey, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (m *Manager) publishOnce(ctx context.Context, exchange, routingKey string, mandatory bool, msg amqp091.Publishing) error {
+	m.mu.RLock()
+	s, t, connected := m.session, m.tracker, m.connected
+	m.mu.RUnlock()
+	if !connected {
+		return ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+	return t.publish(ctx, s.Channel(), exchange, routingKey, mandatory, msg)
+}
+
+func newMessageID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
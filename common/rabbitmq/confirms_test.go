@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestTrackerRun(t *testing.T) {
+	unroutable := &amqp091.Return{MessageId: "m1", Exchange: "products", RoutingKey: "product.insert", ReplyCode: 312, ReplyText: "NO_ROUTE"}
+	tests := []struct {
+		name     string
+		returned *amqp091.Return
+		ack      bool
+		closed   bool
+		want     error
+	}{
+		{"acked", nil, true, false, nil},
+		{"nacked", nil, false, false, ErrNacked},
+		{"returned", unroutable, true, false, &ReturnError{Exchange: "products", RoutingKey: "product.insert", Code: 312, Text: "NO_ROUTE"}},
+		{"other message returned", &amqp091.Return{MessageId: "m2", ReplyCode: 312}, true, false, nil},
+		{"channel closed", nil, false, true, ErrNotConnected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &tracker{
+				pending: make(map[uint64]*pendingPublish),
+				byID:    make(map[string]*pendingPublish),
+			}
+			p := &pendingPublish{messageID: "m1", done: make(chan error, 1)}
+			tr.pending[1] = p
+			tr.byID["m1"] = p
+
+			confirms := make(chan amqp091.Confirmation, 1)
+			returns := make(chan amqp091.Return, 1)
+			// The broker sends a return before the ack of its message
+			if tt.returned != nil {
+				returns <- *tt.returned
+			}
+			if tt.closed {
+				close(confirms)
+			} else {
+				confirms <- amqp091.Confirmation{DeliveryTag: 1, Ack: tt.ack}
+			}
+			go tr.run(confirms, returns)
+
+			err := <-p.done
+			var want *ReturnError
+			if errors.As(tt.want, &want) {
+				var got *ReturnError
+				if !errors.As(err, &got) || *got != *want || !errors.Is(err, ErrUnroutable) {
+					t.Errorf("publish error = %v, want %v", err, tt.want)
+				}
+			} else if err != tt.want {
+				t.Errorf("publish error = %v, want %v", err, tt.want)
+			}
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			if len(tr.pending) != 0 || len(tr.byID) != 0 {
+				t.Errorf("still tracking %v, %v", tr.pending, tr.byID)
+			}
+		})
+	}
+}
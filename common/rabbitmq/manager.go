@@ -0,0 +1,414 @@
+// Package rabbitmq keeps a RabbitMQ connection alive across broker restarts.
+// A Manager reconnects with backoff when its connection or channel closes,
+// re-declares the topology registered with OnConnect and re-registers the
+// consumers started with Consume, so publishers and consumers carry on
+// without restarting the process. Its channel is in confirm mode: Publish
+// waits for the broker to take each message.
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// ErrNotConnected is returned while the manager is reconnecting.
+var ErrNotConnected = errors.New("rabbitmq: not connected")
+
+// ErrClosed is returned once the manager has been closed.
+var ErrClosed = errors.New("rabbitmq: manager closed")
+
+// Setup declares topology on a freshly opened channel.
+type Setup func(ch *amqp091.Channel) error
+
+// Consumer describes a queue consumer that survives reconnects.
+type Consumer struct {
+	Queue     string
+	AutoAck   bool
+	Exclusive bool
+	Args      amqp091.Table
+	// Handle is called for every delivery, one at a time.
+	Handle func(d amqp091.Delivery)
+}
+
+// session is the connection and channel a Manager works on. Tests stand
+// in a fake broker for the amqpSession used in production.
+type session interface {
+	// Channel returns the channel setups declare on and publishes go to.
+	Channel() *amqp091.Channel
+	Consume(queue, tag string, autoAck, exclusive bool, args amqp091.Table) (<-chan amqp091.Delivery, error)
+	Cancel(tag string) error
+	// NotifyClose returns a channel that receives once the connection or
+	// the channel closes.
+	NotifyClose() <-chan *amqp091.Error
+	Close() error
+}
+
+type amqpSession struct {
+	conn *amqp091.Connection
+	ch   *amqp091.Channel
+}
+
+func (s *amqpSession) Channel() *amqp091.Channel {
+	return s.ch
+}
+
+func (s *amqpSession) Consume(queue, tag string, autoAck, exclusive bool, args amqp091.Table) (<-chan amqp091.Delivery, error) {
+	return s.ch.Consume(queue, tag, autoAck, exclusive, false, false, args)
+}
+
+func (s *amqpSession) Cancel(tag string) error {
+	return s.ch.Cancel(tag, false)
+}
+
+func (s *amqpSession) NotifyClose() <-chan *amqp091.Error {
+	connClosed := s.conn.NotifyClose(make(chan *amqp091.Error, 1))
+	chClosed := s.ch.NotifyClose(make(chan *amqp091.Error, 1))
+	closed := make(chan *amqp091.Error, 1)
+	// Both are closed when the connection goes, so this always returns
+	go func() {
+		select {
+		case reason := <-connClosed:
+			closed <- reason
+		case reason := <-chClosed:
+			closed <- reason
+		}
+	}()
+	return closed
+}
+
+func (s *amqpSession) Close() error {
+	return s.conn.Close()
+}
+
+// Manager owns a connection and channel to RabbitMQ and replaces them when
+// they close.
+type Manager struct {
+	open func() (session, *tracker, error)
+
+	mu        sync.RWMutex
+	session   session
+	tracker   *tracker
+	connected bool
+	// replaced is closed when session is swapped for a new one.
+	replaced  chan struct{}
+	setups    []Setup
+	consuming map[string]bool
+	// tags holds the tag of every consumer, kept across reconnects.
+	tags     map[string]bool
+	stopping bool
+	stop     chan struct{}
+	handlers sync.WaitGroup
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to url and keeps the connection alive until Close.
+func Dial(url string) (*Manager, error) {
+	return dial(func() (session, *tracker, error) {
+		return openAMQP(url)
+	})
+}
+
+// dial connects with open, which reconnects use as well.
+func dial(open func() (session, *tracker, error)) (*Manager, error) {
+	m := &Manager{
+		open:      open,
+		replaced:  make(chan struct{}),
+		consuming: make(map[string]bool),
+		tags:      make(map[string]bool),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	s, t, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	m.session, m.tracker, m.connected = s, t, true
+	go m.watch(s)
+	return m, nil
+}
+
+func openAMQP(url string) (session, *tracker, error) {
+	conn, err := amqp091.Dial(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	t, err := track(ch)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return &amqpSession{conn: conn, ch: ch}, t, nil
+}
+
+// OnConnect runs setup now and again after every reconnect, before the
+// consumers are re-registered.
+func (m *Manager) OnConnect(setup Setup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.connected {
+		return ErrNotConnected
+	}
+	if err := setup(m.session.Channel()); err != nil {
+		return err
+	}
+	m.setups = append(m.setups, setup)
+	return nil
+}
+
+// Channel returns the current channel, or nil while reconnecting. Callers
+// should not keep it: it is replaced after a reconnect.
+func (m *Manager) Channel() *amqp091.Channel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.connected {
+		return nil
+	}
+	return m.session.Channel()
+}
+
+// Consume starts c and restarts it on every new channel. The first
+// registration happens before Consume returns, so a missing queue is
+// reported to the caller.
+func (m *Manager) Consume(c Consumer) error {
+	tag := c.Queue + "-" + newMessageID()
+
+	// The lock keeps StopConsuming from running between the checks and the
+	// registration
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return ErrClosed
+	}
+	if !m.connected {
+		return ErrNotConnected
+	}
+
+	msgs, err := m.session.Consume(c.Queue, tag, c.AutoAck, c.Exclusive, c.Args)
+	if err != nil {
+		return err
+	}
+	m.tags[tag] = true
+	m.handlers.Add(1)
+	go m.runConsumer(c, tag, msgs, m.replaced)
+	return nil
+}
+
+func (m *Manager) runConsumer(c Consumer, tag string, msgs <-chan amqp091.Delivery, replaced chan struct{}) {
+	defer m.handlers.Done()
+	for {
+		if msgs != nil {
+			m.setConsuming(c.Queue, true)
+			for d := range msgs {
+				c.Handle(d)
+			}
+			m.setConsuming(c.Queue, false)
+			msgs = nil
+		}
+
+		// Wait for the next channel
+		select {
+		case <-replaced:
+		case <-m.stop:
+			return
+		case <-m.done:
+			return
+		}
+
+		msgs, replaced = m.reconsume(c, tag)
+		if msgs == nil {
+			continue
+		}
+		log.Printf("rabbitmq: consumer of %s re-registered", c.Queue)
+	}
+}
+
+// reconsume registers c again on the current channel, unless the manager is
+// stopping. It returns the channel to wait on before trying again.
+func (m *Manager) reconsume(c Consumer, tag string) (<-chan amqp091.Delivery, chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return nil, m.replaced
+	}
+	msgs, err := m.session.Consume(c.Queue, tag, c.AutoAck, c.Exclusive, c.Args)
+	if err != nil {
+		// The channel is gone again; the next reconnect retries
+		log.Printf("rabbitmq: re-register consumer of %s: %v", c.Queue, err)
+		return nil, m.replaced
+	}
+	return msgs, m.replaced
+}
+
+func (m *Manager) setConsuming(queue string, consuming bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consuming[queue] = consuming
+}
+
+// StopConsuming cancels every consumer so the broker stops delivering, then
+// waits until the deliveries already received are handled or ctx is done.
+// The connection stays open, so handlers can still publish; call Close
+// afterwards.
+func (m *Manager) StopConsuming(ctx context.Context) error {
+	m.mu.Lock()
+	var s session
+	var tags []string
+	if !m.stopping {
+		m.stopping = true
+		close(m.stop)
+		if m.connected {
+			s = m.session
+			for tag := range m.tags {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	// No consumer registers once stopping is set. A consumer whose channel
+	// closes instead of being cancelled returns all the same.
+	for _, tag := range tags {
+		if err := s.Cancel(tag); err != nil {
+			log.Printf("rabbitmq: cancel consumer %s: %v", tag, err)
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		m.handlers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check reports whether the manager is connected, for readiness checks.
+func (m *Manager) Check(context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.connected {
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// ConsumerCheck returns a check that fails while the consumer of queue is
+// not receiving deliveries.
+func (m *Manager) ConsumerCheck(queue string) func(context.Context) error {
+	return func(context.Context) error {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		if !m.consuming[queue] {
+			return fmt.Errorf("consumer of %s is not running", queue)
+		}
+		return nil
+	}
+}
+
+// watch waits for s to close and replaces it.
+func (m *Manager) watch(s session) {
+	for {
+		var reason *amqp091.Error
+		select {
+		case reason = <-s.NotifyClose():
+		case <-m.done:
+			return
+		}
+		log.Printf("rabbitmq: connection lost: %v", reason)
+
+		m.mu.Lock()
+		m.connected = false
+		m.mu.Unlock()
+		s.Close()
+
+		var ok bool
+		s, ok = m.reconnect()
+		if !ok {
+			return
+		}
+	}
+}
+
+// reconnect dials until it succeeds and the topology is declared again, or
+// the manager is closed.
+func (m *Manager) reconnect() (session, bool) {
+	backoff := minBackoff
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-m.done:
+			return nil, false
+		}
+
+		s, t, err := m.open()
+		if err == nil {
+			err = m.redeclare(s.Channel())
+			if err != nil {
+				s.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("rabbitmq: reconnect failed, retrying in %s: %v", backoff, err)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+
+		m.mu.Lock()
+		m.session, m.tracker, m.connected = s, t, true
+		close(m.replaced)
+		m.replaced = make(chan struct{})
+		m.mu.Unlock()
+		log.Printf("rabbitmq: reconnected")
+		return s, true
+	}
+}
+
+func (m *Manager) redeclare(ch *amqp091.Channel) error {
+	m.mu.RLock()
+	setups := append([]Setup(nil), m.setups...)
+	m.mu.RUnlock()
+	for _, setup := range setups {
+		if err := setup(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops reconnecting and closes the connection.
+func (m *Manager) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.connected = false
+		err = m.session.Close()
+	})
+	return err
+}
@@ -0,0 +1,286 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakeBroker opens fake sessions in place of connections to RabbitMQ.
+type fakeBroker struct {
+	opened chan *fakeSession
+
+	mu sync.Mutex
+	// refuse is how many of the next sessions fail to register consumers.
+	refuse int
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{opened: make(chan *fakeSession, 4)}
+}
+
+func (b *fakeBroker) open() (session, *tracker, error) {
+	b.mu.Lock()
+	s := &fakeSession{
+		refuse:     b.refuse > 0,
+		deliveries: make(map[string]chan amqp091.Delivery),
+		registered: make(chan string, 4),
+		closed:     make(chan *amqp091.Error, 1),
+	}
+	b.refuse--
+	b.mu.Unlock()
+	b.opened <- s
+	return s, nil, nil
+}
+
+// next waits for the manager to open a session.
+func (b *fakeBroker) next(t *testing.T) *fakeSession {
+	t.Helper()
+	select {
+	case s := <-b.opened:
+		return s
+	case <-time.After(testTimeout):
+		t.Fatal("manager did not connect")
+		return nil
+	}
+}
+
+type fakeSession struct {
+	refuse bool
+
+	mu         sync.Mutex
+	deliveries map[string]chan amqp091.Delivery
+	registered chan string
+	closed     chan *amqp091.Error
+	down       bool
+}
+
+func (s *fakeSession) Channel() *amqp091.Channel {
+	return nil
+}
+
+func (s *fakeSession) Consume(queue, tag string, autoAck, exclusive bool, args amqp091.Table) (<-chan amqp091.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down || s.refuse {
+		return nil, amqp091.ErrClosed
+	}
+	d := make(chan amqp091.Delivery)
+	s.deliveries[tag] = d
+	s.registered <- tag
+	return d, nil
+}
+
+func (s *fakeSession) Cancel(tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.deliveries[tag]; ok {
+		close(d)
+		delete(s.deliveries, tag)
+	}
+	return nil
+}
+
+func (s *fakeSession) NotifyClose() <-chan *amqp091.Error {
+	return s.closed
+}
+
+func (s *fakeSession) Close() error {
+	s.shutdown(nil)
+	return nil
+}
+
+// drop closes the session the way a broker restart does.
+func (s *fakeSession) drop() {
+	s.shutdown(&amqp091.Error{Code: amqp091.ConnectionForced, Reason: "CONNECTION_FORCED - broker forced connection closure"})
+}
+
+func (s *fakeSession) shutdown(reason *amqp091.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return
+	}
+	s.down = true
+	for tag, d := range s.deliveries {
+		close(d)
+		delete(s.deliveries, tag)
+	}
+	if reason != nil {
+		s.closed <- reason
+	}
+	close(s.closed)
+}
+
+// consumer waits for a consumer to register and returns its tag.
+func (s *fakeSession) consumer(t *testing.T) string {
+	t.Helper()
+	select {
+	case tag := <-s.registered:
+		return tag
+	case <-time.After(testTimeout):
+		t.Fatal("consumer did not register")
+		return ""
+	}
+}
+
+func (s *fakeSession) deliver(t *testing.T, tag, body string) {
+	t.Helper()
+	s.mu.Lock()
+	d := s.deliveries[tag]
+	s.mu.Unlock()
+	select {
+	case d <- amqp091.Delivery{ConsumerTag: tag, Body: []byte(body)}:
+	case <-time.After(testTimeout):
+		t.Fatalf("consumer %s did not take %q", tag, body)
+	}
+}
+
+func wantHandled(t *testing.T, handled <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-handled:
+		if got != want {
+			t.Errorf("handled %q, want %q", got, want)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("%q was not handled", want)
+	}
+}
+
+func TestManagerReconsumesAfterReconnect(t *testing.T) {
+	broker := newFakeBroker()
+	m, err := dial(broker.open)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer m.Close()
+	first := broker.next(t)
+
+	var setups atomic.Int32
+	if err := m.OnConnect(func(*amqp091.Channel) error {
+		setups.Add(1)
+		return nil
+	}); err != nil {
+		t.Fatalf("OnConnect: %v", err)
+	}
+	handled := make(chan string)
+	if err := m.Consume(Consumer{Queue: "q", Handle: func(d amqp091.Delivery) {
+		handled <- string(d.Body)
+	}}); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	tag := first.consumer(t)
+	first.deliver(t, tag, "before")
+	wantHandled(t, handled, "before")
+
+	first.drop()
+	second := broker.next(t)
+	if got := second.consumer(t); got != tag {
+		t.Errorf("re-registered as %q, want %q", got, tag)
+	}
+	if got := setups.Load(); got != 2 {
+		t.Errorf("setup ran %d times before the consumer re-registered, want 2", got)
+	}
+	second.deliver(t, tag, "after")
+	wantHandled(t, handled, "after")
+	if err := m.Check(context.Background()); err != nil {
+		t.Errorf("Check = %v, want nil", err)
+	}
+	if err := m.ConsumerCheck("q")(context.Background()); err != nil {
+		t.Errorf("ConsumerCheck = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := m.StopConsuming(ctx); err != nil {
+		t.Fatalf("StopConsuming: %v", err)
+	}
+	second.drop()
+	third := broker.next(t)
+	select {
+	case tag := <-third.registered:
+		t.Errorf("consumer %s registered again after StopConsuming", tag)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestManagerReconsumesOnLaterChannel(t *testing.T) {
+	broker := newFakeBroker()
+	m, err := dial(broker.open)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer m.Close()
+	first := broker.next(t)
+
+	handled := make(chan string)
+	if err := m.Consume(Consumer{Queue: "q", Handle: func(d amqp091.Delivery) {
+		handled <- string(d.Body)
+	}}); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	tag := first.consumer(t)
+
+	// The first new channel closes again before the consumer gets on it
+	broker.mu.Lock()
+	broker.refuse = 1
+	broker.mu.Unlock()
+	first.drop()
+	second := broker.next(t)
+	if err := m.ConsumerCheck("q")(context.Background()); err == nil {
+		t.Error("ConsumerCheck = nil while the consumer is not registered")
+	}
+	second.drop()
+
+	third := broker.next(t)
+	if got := third.consumer(t); got != tag {
+		t.Errorf("re-registered as %q, want %q", got, tag)
+	}
+	third.deliver(t, tag, "after")
+	wantHandled(t, handled, "after")
+}
+
+func TestStopConsumingDrains(t *testing.T) {
+	broker := newFakeBroker()
+	m, err := dial(broker.open)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer m.Close()
+	first := broker.next(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := m.Consume(Consumer{Queue: "q", Handle: func(amqp091.Delivery) {
+		close(started)
+		<-release
+	}}); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	tag := first.consumer(t)
+	first.deliver(t, tag, "in flight")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.StopConsuming(ctx); err != context.DeadlineExceeded {
+		t.Errorf("StopConsuming with a handler running = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := m.Consume(Consumer{Queue: "q2", Handle: func(amqp091.Delivery) {}}); err != ErrClosed {
+		t.Errorf("Consume after StopConsuming = %v, want %v", err, ErrClosed)
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := m.StopConsuming(ctx); err != nil {
+		t.Errorf("StopConsuming once the handler returned = %v, want nil", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Package requestid carries the X-Request-ID correlation ID of a request in
+// a context, so the logs and messages it causes can be tied back to it.
+package requestid
+
+import (
+	"context"
+	"log"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Header is the AMQP message header that carries the correlation ID.
+const Header = "x-request-id"
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying the correlation ID requestID.
+func With(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// FromContext returns the correlation ID carried by ctx, or "" if there is
+// none.
+func FromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
+
+// Inject writes the correlation ID of ctx into headers, if it has one.
+func Inject(ctx context.Context, headers amqp091.Table) {
+	if requestID := FromContext(ctx); requestID != "" {
+		headers[Header] = requestID
+	}
+}
+
+// Extract returns a copy of ctx carrying the correlation ID of a message
+// with headers.
+func Extract(ctx context.Context, headers amqp091.Table) context.Context {
+	requestID, _ := headers[Header].(string)
+	return With(ctx, requestID)
+}
+
+// Logf logs like log.Printf, prefixed with the correlation ID of ctx.
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	if requestID := FromContext(ctx); requestID != "" {
+		format = "[request_id=%s] " + format
+		args = append([]interface{}{requestID}, args...)
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,71 @@
+package requestid
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		want      amqp091.Table
+	}{
+		{"with a request ID", "r1", amqp091.Table{"x-tenant-id": "t1", Header: "r1"}},
+		{"without one", "", amqp091.Table{"x-tenant-id": "t1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.requestID != "" {
+				ctx = With(ctx, tt.requestID)
+			}
+			headers := amqp091.Table{"x-tenant-id": "t1"}
+			Inject(ctx, headers)
+			if !reflect.DeepEqual(headers, tt.want) {
+				t.Errorf("headers = %v, want %v", headers, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp091.Table
+		want    string
+	}{
+		{"set", amqp091.Table{Header: "r1"}, "r1"},
+		{"missing", amqp091.Table{}, ""},
+		{"no headers", nil, ""},
+		{"not a string", amqp091.Table{Header: int32(1)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromContext(Extract(context.Background(), tt.headers)); got != tt.want {
+				t.Errorf("request ID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// A message published while handling a request carries its ID to the
+	// consumer, and on into what the consumer publishes in turn
+	published := amqp091.Table{}
+	Inject(With(context.Background(), "r1"), published)
+
+	ctx := Extract(context.Background(), published)
+	republished := amqp091.Table{}
+	Inject(ctx, republished)
+
+	if got := FromContext(ctx); got != "r1" {
+		t.Errorf("consumer request ID = %q, want r1", got)
+	}
+	if got := republished[Header]; got != "r1" {
+		t.Errorf("republished header = %v, want r1", got)
+	}
+}
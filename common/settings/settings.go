@@ -0,0 +1,337 @@
+// Package settings loads a service's configuration into a struct whose
+// fields name their environment variable in tags:
+//
+//	type Config struct {
+//		Addr     string        `env:"HTTP_ADDR" default:":8080" usage:"address the API listens on"`
+//		MongoURI string        `env:"MONGO_URI" required:"true" secret:"true"`
+//		Timeout  time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s"`
+//	}
+//
+// Every field can also be set with a flag named after its variable, such as
+// -mongo-uri. A value is taken from, in decreasing precedence, the command
+// line, the environment, the config file and the default. The config file is
+// in .env format and is read from -config or CONFIG_FILE, or from .env when
+// neither is set and it exists. A secret can be read instead from the file
+// named by <VAR>_FILE or -<flag>-file, as Docker and Kubernetes mount them.
+//
+// Load checks every value and reports all the problems together, so a
+// service fails at startup rather than on first use.
+package settings
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Sources a value can come from.
+const (
+	FromDefault = "default"
+	FromFile    = "file"
+	FromEnv     = "env"
+	FromFlag    = "flag"
+)
+
+const redacted = "xxxxx"
+
+// Validator is implemented by configurations with checks across fields.
+// Validate runs once every field is set; it may return several errors with
+// errors.Join.
+type Validator interface {
+	Validate() error
+}
+
+// Error lists every problem found while loading a configuration.
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// setting is one field of a configuration.
+type setting struct {
+	env      string
+	flag     string
+	def      string
+	usage    string
+	secret   bool
+	required bool
+	value    reflect.Value
+
+	source string
+}
+
+// Effective is a loaded configuration with where each value came from.
+type Effective struct {
+	settings []*setting
+}
+
+// String lists the settings one per line with their source. Secrets are
+// redacted.
+func (e *Effective) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, s := range e.settings {
+		value := format(s.value)
+		if s.secret {
+			value = redact(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t(%s)\n", s.env, value, s.source)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// Load fills the struct cfg points to from args, the command line without
+// the program name, the environment, the config file and the defaults. With
+// -print-config it prints the effective configuration and exits; like the
+// flag package, it exits on -h and on a malformed command line.
+func Load(cfg interface{}, args []string) (*Effective, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("settings: Load needs a pointer to a struct, got %T", cfg)
+	}
+	v = v.Elem()
+
+	eff := &Effective{}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		env := f.Tag.Get("env")
+		if env == "" || !f.IsExported() {
+			continue
+		}
+		eff.settings = append(eff.settings, &setting{
+			env:      env,
+			flag:     strings.ReplaceAll(strings.ToLower(env), "_", "-"),
+			def:      f.Tag.Get("default"),
+			usage:    f.Tag.Get("usage"),
+			secret:   f.Tag.Get("secret") == "true",
+			required: f.Tag.Get("required") == "true",
+			value:    v.Field(i),
+		})
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "config file in .env format (env CONFIG_FILE, default .env if present)")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+	flags := make(map[string]*string)
+	for _, s := range eff.settings {
+		usage := s.usage
+		if usage != "" {
+			usage += " "
+		}
+		usage += "(env " + s.env
+		if s.def != "" {
+			usage += ", default " + s.def
+		}
+		usage += ")"
+		flags[s.flag] = fs.String(s.flag, "", usage)
+		if s.secret {
+			flags[s.flag+"-file"] = fs.String(s.flag+"-file", "", "file to read -"+s.flag+" from (env "+s.env+"_FILE)")
+		}
+	}
+	fs.Parse(args)
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var problems []string
+	file, err := readConfigFile(*configFile, set["config"])
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for _, s := range eff.settings {
+		layers := []struct {
+			source      string
+			value, path string
+			name        string
+		}{
+			{FromFlag, flagValue(flags, set, s.flag), flagValue(flags, set, s.flag+"-file"), "-" + s.flag},
+			{FromEnv, os.Getenv(s.env), secretEnv(s, os.Getenv), s.env},
+			{FromFile, file[s.env], secretEnv(s, func(key string) string { return file[key] }), s.env + " in the config file"},
+		}
+
+		raw := s.def
+		s.source = FromDefault
+		for _, l := range layers {
+			if l.value != "" && l.path != "" {
+				problems = append(problems, fmt.Sprintf("%s: set both %s and its file", s.env, l.name))
+				break
+			}
+			if l.path != "" {
+				data, err := os.ReadFile(l.path)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s: read secret file: %v", s.env, err))
+					break
+				}
+				raw, s.source = strings.TrimSpace(string(data)), l.source
+				break
+			}
+			if l.value != "" {
+				raw, s.source = l.value, l.source
+				break
+			}
+		}
+
+		if raw == "" {
+			if s.required {
+				problems = append(problems, fmt.Sprintf("%s: required, set %s or -%s", s.env, s.env, s.flag))
+			}
+			continue
+		}
+		if err := parse(s.value, raw); err != nil {
+			shown := strconv.Quote(raw)
+			if s.secret {
+				shown = "value"
+			}
+			problems = append(problems, fmt.Sprintf("%s: invalid %s from %s: %v", s.env, shown, s.source, err))
+		}
+	}
+
+	export(file)
+
+	if validator, ok := cfg.(Validator); ok && len(problems) == 0 {
+		if err := validator.Validate(); err != nil {
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, err := range joined.Unwrap() {
+					problems = append(problems, err.Error())
+				}
+			} else {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return eff, &Error{Problems: problems}
+	}
+
+	if *printConfig {
+		fmt.Print(eff)
+		os.Exit(0)
+	}
+	return eff, nil
+}
+
+// readConfigFile reads the config file. A missing .env is not an error, but
+// a file named by -config or CONFIG_FILE has to exist.
+func readConfigFile(path string, fromFlag bool) (map[string]string, error) {
+	explicit := fromFlag
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+		explicit = path != ""
+	}
+	if path == "" {
+		path = ".env"
+	}
+	values, err := godotenv.Read(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	return values, nil
+}
+
+// export sets the variables of the config file the environment does not,
+// as godotenv.Load does, so libraries that read their own variables see
+// them.
+func export(file map[string]string) {
+	for key, value := range file {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+func flagValue(flags map[string]*string, set map[string]bool, name string) string {
+	if !set[name] {
+		return ""
+	}
+	return *flags[name]
+}
+
+// secretEnv returns the <VAR>_FILE path of a secret setting.
+func secretEnv(s *setting, get func(string) string) string {
+	if !s.secret {
+		return ""
+	}
+	return get(s.env + "_FILE")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func parse(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("not a duration such as 30s or 5m")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("not true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("not a whole number")
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// redact hides a secret. The scheme, host and path of a URL are kept so the
+// printed configuration still shows where a service connects.
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redacted
+	}
+	s := u.Scheme + "://"
+	if u.User != nil {
+		s += redacted + "@"
+	}
+	s += u.Host + u.Path
+	if u.RawQuery != "" {
+		s += "?" + redacted
+	}
+	return s
+}
@@ -0,0 +1,255 @@
+// Package topology defines the RabbitMQ exchanges, queues and bindings the
+// services exchange messages through. Every service declares Default when it
+// connects, so the broker ends up with the same topology whichever service
+// starts first, and the names here are the only copy the services use.
+package topology
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Exchanges.
+const (
+	ProductExchange = "product_exchange"
+	ErrorExchange   = "error_exchange"
+	// ProductEvents fans catalog changes out to feed subscribers such as the
+	// websocket service.
+	ProductEvents = "product_events"
+)
+
+// Queues.
+const (
+	ProductInsertQueue   = "product_insert_queue"
+	ProductUpdateQueue   = "product_update_queue"
+	RefundCompletedQueue = "refund_completed_queue"
+	StoreQueue           = "store_queue"
+	StoreProductQueue    = "store_product_queue"
+	PurchaseOrderQueue   = "purchase_order_queue"
+	ProductDLQ           = "product_dlq"
+	LoggingQueue         = "logging_queue"
+	// ProductEventsStream keeps the catalog changes on product_events so
+	// feed subscribers read them in one order, with the stream offset as
+	// their sequence number, whichever instance serves them.
+	ProductEventsStream = "product_events_stream"
+)
+
+// Routing keys.
+const (
+	KeyProductInsert      = "product.insert"
+	KeyProductUpdate      = "product.update"
+	KeyProductDelete      = "product.delete"
+	KeyRefundCompleted    = "refund.completed"
+	KeyStoreUpsert        = "store.upsert"
+	KeyStoreProductUpdate = "store.product.update"
+	KeyDeadLetter         = "product.dlq"
+)
+
+// PurchaseOrderKey returns the routing key of purchase order events in status.
+func PurchaseOrderKey(status string) string {
+	return "purchaseorder." + status
+}
+
+// LoggingKey returns the routing key of log entries of level.
+func LoggingKey(level string) string {
+	return "logging." + level
+}
+
+// Queue types.
+const (
+	Classic = "classic"
+	Quorum  = "quorum"
+	Stream  = "stream"
+)
+
+// Overflow behaviours of a queue at its max length.
+const (
+	DropHead      = "drop-head"
+	RejectPublish = "reject-publish"
+)
+
+// Exchange is a durable exchange.
+type Exchange struct {
+	Name string
+	Kind string
+}
+
+// Queue is a durable queue and the policy it is declared with. Zero fields
+// are left to the broker defaults.
+type Queue struct {
+	Name                 string
+	Type                 string
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	MessageTTL           time.Duration
+	MaxLength            int
+	Overflow             string
+	// DeliveryLimit dead-letters a message after that many redeliveries.
+	// Quorum queues only.
+	DeliveryLimit int
+	// MaxAge drops segments whose messages are all older than it, and
+	// MaxSegmentBytes sets how large a segment grows. Streams only.
+	MaxAge          time.Duration
+	MaxSegmentBytes int
+}
+
+// Args returns the queue arguments q is declared with.
+func (q Queue) Args() amqp091.Table {
+	args := amqp091.Table{}
+	if q.Type != "" {
+		args["x-queue-type"] = q.Type
+	}
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = int64(q.MaxLength)
+	}
+	if q.Overflow != "" {
+		args["x-overflow"] = q.Overflow
+	}
+	if q.DeliveryLimit > 0 {
+		args["x-delivery-limit"] = int64(q.DeliveryLimit)
+	}
+	if q.MaxAge > 0 {
+		args["x-max-age"] = fmt.Sprintf("%ds", int64(q.MaxAge.Seconds()))
+	}
+	if q.MaxSegmentBytes > 0 {
+		args["x-stream-max-segment-size-bytes"] = int64(q.MaxSegmentBytes)
+	}
+	return args
+}
+
+// Binding routes messages published on Source with Key to a queue, or to
+// another exchange when ToExchange is set.
+type Binding struct {
+	Source      string
+	Key         string
+	Destination string
+	ToExchange  bool
+}
+
+// Topology is a set of exchanges, queues and bindings.
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+// workQueue returns a queue of product-service events consumed by
+// consumer-service. Messages that keep failing are dead-lettered to
+// product_dlq, and publishes are refused once the backlog is full so the
+// publisher confirm reports it.
+func workQueue(name string) Queue {
+	return Queue{
+		Name:                 name,
+		Type:                 Quorum,
+		DeadLetterExchange:   ErrorExchange,
+		DeadLetterRoutingKey: KeyDeadLetter,
+		MaxLength:            100000,
+		Overflow:             RejectPublish,
+		DeliveryLimit:        5,
+	}
+}
+
+// Default is the topology every service declares.
+var Default = Topology{
+	Exchanges: []Exchange{
+		{Name: ProductExchange, Kind: amqp091.ExchangeDirect},
+		{Name: ErrorExchange, Kind: amqp091.ExchangeDirect},
+		{Name: ProductEvents, Kind: amqp091.ExchangeTopic},
+	},
+	Queues: []Queue{
+		workQueue(ProductInsertQueue),
+		workQueue(ProductUpdateQueue),
+		workQueue(RefundCompletedQueue),
+		workQueue(StoreQueue),
+		workQueue(StoreProductQueue),
+		workQueue(PurchaseOrderQueue),
+		{
+			Name:       ProductDLQ,
+			Type:       Quorum,
+			MessageTTL: 7 * 24 * time.Hour,
+			MaxLength:  100000,
+			Overflow:   RejectPublish,
+		},
+		{
+			// Old entries are dropped rather than blocking the services
+			// that log
+			Name:       LoggingQueue,
+			Type:       Quorum,
+			MessageTTL: 3 * 24 * time.Hour,
+			MaxLength:  1000000,
+			Overflow:   DropHead,
+		},
+		{
+			Name:            ProductEventsStream,
+			Type:            Stream,
+			MaxAge:          24 * time.Hour,
+			MaxSegmentBytes: 10 << 20,
+		},
+	},
+	Bindings: []Binding{
+		{Source: ProductExchange, Key: KeyProductInsert, Destination: ProductEvents, ToExchange: true},
+		{Source: ProductExchange, Key: KeyProductUpdate, Destination: ProductEvents, ToExchange: true},
+		{Source: ProductExchange, Key: KeyProductDelete, Destination: ProductEvents, ToExchange: true},
+		{Source: ProductExchange, Key: KeyStoreProductUpdate, Destination: ProductEvents, ToExchange: true},
+		{Source: ProductEvents, Key: KeyProductInsert, Destination: ProductEventsStream},
+		{Source: ProductEvents, Key: KeyProductUpdate, Destination: ProductEventsStream},
+		{Source: ProductEvents, Key: KeyProductDelete, Destination: ProductEventsStream},
+		{Source: ProductEvents, Key: KeyStoreProductUpdate, Destination: ProductEventsStream},
+
+		{Source: ProductExchange, Key: KeyProductInsert, Destination: ProductInsertQueue},
+		{Source: ProductExchange, Key: KeyProductUpdate, Destination: ProductUpdateQueue},
+		{Source: ProductExchange, Key: KeyRefundCompleted, Destination: RefundCompletedQueue},
+		{Source: ProductExchange, Key: KeyStoreUpsert, Destination: StoreQueue},
+		{Source: ProductExchange, Key: KeyStoreProductUpdate, Destination: StoreProductQueue},
+		{Source: ProductExchange, Key: PurchaseOrderKey("draft"), Destination: PurchaseOrderQueue},
+		{Source: ProductExchange, Key: PurchaseOrderKey("sent"), Destination: PurchaseOrderQueue},
+		{Source: ProductExchange, Key: PurchaseOrderKey("partially_received"), Destination: PurchaseOrderQueue},
+		{Source: ProductExchange, Key: PurchaseOrderKey("closed"), Destination: PurchaseOrderQueue},
+
+		{Source: ErrorExchange, Key: KeyDeadLetter, Destination: ProductDLQ},
+		{Source: ErrorExchange, Key: LoggingKey("debug"), Destination: LoggingQueue},
+		{Source: ErrorExchange, Key: LoggingKey("info"), Destination: LoggingQueue},
+		{Source: ErrorExchange, Key: LoggingKey("warn"), Destination: LoggingQueue},
+		{Source: ErrorExchange, Key: LoggingKey("error"), Destination: LoggingQueue},
+	},
+}
+
+// Declare declares t on ch. Declaring an existing entity with the same
+// settings is a no-op, so it is safe to run on every connect; an entity that
+// exists with other settings fails with PRECONDITION_FAILED, which the
+// topology-diff command reports ahead of time and replaces with -migrate.
+func (t Topology) Declare(ch *amqp091.Channel) error {
+	for _, e := range t.Exchanges {
+		if err := ch.ExchangeDeclare(e.Name, e.Kind, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("declare exchange '%s': %w", e.Name, err)
+		}
+	}
+	for _, q := range t.Queues {
+		if _, err := ch.QueueDeclare(q.Name, true, false, false, false, q.Args()); err != nil {
+			return fmt.Errorf("declare queue '%s' (run topology-diff -migrate to replace a queue declared with other settings): %w", q.Name, err)
+		}
+	}
+	for _, b := range t.Bindings {
+		var err error
+		if b.ToExchange {
+			err = ch.ExchangeBind(b.Destination, b.Key, b.Source, false, nil)
+		} else {
+			err = ch.QueueBind(b.Destination, b.Key, b.Source, false, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("bind '%s' to '%s' with '%s': %w", b.Destination, b.Source, b.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package tracing sets up OpenTelemetry for a service and carries trace
+// context across RabbitMQ messages.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of the service named by Init.
+var tracer = otel.Tracer("")
+
+// Tracer returns the tracer spans of the service are started with.
+func Tracer() trace.Tracer {
+	return tracer
+}
+
+// Init installs the W3C trace context propagator and, unless exporter is
+// empty or unknown, a tracer provider for serviceName exporting to OTLP
+// ("otlp", at OTEL_EXPORTER_OTLP_ENDPOINT, default localhost:4318) or to
+// file ("file"). The returned function flushes and stops the provider.
+func Init(ctx context.Context, serviceName, exporter, file string) (func(context.Context) error, error) {
+	tracer = otel.Tracer(serviceName)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var out *os.File
+	switch exporter {
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		spanExporter = exp
+	case "file":
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("create file exporter: %w", err)
+		}
+		spanExporter, out = exp, f
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if out != nil {
+			out.Close()
+		}
+		return err
+	}, nil
+}
+
+// AMQPCarrier adapts AMQP message headers to a propagation.TextMapCarrier.
+type AMQPCarrier amqp091.Table
+
+func (c AMQPCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c AMQPCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c AMQPCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Inject writes the trace context of ctx into headers.
+func Inject(ctx context.Context, headers amqp091.Table) {
+	otel.GetTextMapPropagator().Inject(ctx, AMQPCarrier(headers))
+}
+
+// StartPublish starts a producer span for a message published to exchange
+// with routingKey.
+func StartPublish(ctx context.Context, exchange, routingKey string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "publish "+exchange+" "+routingKey,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", routingKey),
+		))
+}
+
+// StartConsume starts the consumer span of a delivery, continuing the trace
+// carried in its headers.
+func StartConsume(d amqp091.Delivery, queueName string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), AMQPCarrier(d.Headers))
+	return tracer.Start(ctx, "process "+queueName,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.source.name", queueName),
+			attribute.String("messaging.rabbitmq.destination.routing_key", d.RoutingKey),
+		))
+}
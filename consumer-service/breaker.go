@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold is how many publishes in a row may fail before the
+	// breaker opens.
+	breakerThreshold = 5
+	// breakerCooldown is how long the breaker stays open before a single
+	// publish is let through to probe the broker.
+	breakerCooldown = 30 * time.Second
+)
+
+var errBreakerOpen = errors.New("circuit breaker open: RabbitMQ is failing")
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops publishing to a broker that keeps failing, so the
+// messages being processed are spilled at once instead of each waiting out
+// the publish retries.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a publish may be attempted. Once the cooldown has
+// passed, one publish is allowed through and its result decides whether the
+// breaker closes again.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < breakerCooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		// The probe is still in flight
+		return false
+	}
+	return true
+}
+
+// record feeds the result of an allowed publish back to the breaker.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerThreshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	publishBreakerState.Set(float64(state))
+}
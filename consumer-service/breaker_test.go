@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	errPublish := errors.New("publish failed")
+	tests := []struct {
+		name string
+		// results are recorded after an allowed publish each, in order.
+		results   []error
+		sinceOpen time.Duration
+		wantState int
+		wantAllow bool
+	}{
+		{
+			name:      "closed",
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "failures below threshold",
+			results:   []error{errPublish, errPublish, errPublish, errPublish},
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "success resets failures",
+			results:   []error{errPublish, errPublish, errPublish, errPublish, nil, errPublish},
+			wantState: breakerClosed,
+			wantAllow: true,
+		},
+		{
+			name:      "opens at threshold",
+			results:   []error{errPublish, errPublish, errPublish, errPublish, errPublish},
+			wantState: breakerOpen,
+			wantAllow: false,
+		},
+		{
+			name:      "probes after cooldown",
+			results:   []error{errPublish, errPublish, errPublish, errPublish, errPublish},
+			sinceOpen: breakerCooldown,
+			wantState: breakerHalfOpen,
+			wantAllow: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &circuitBreaker{}
+			for _, err := range tt.results {
+				if !b.allow() {
+					t.Fatal("allow = false before the breaker opened")
+				}
+				b.record(err)
+			}
+			b.openedAt = b.openedAt.Add(-tt.sinceOpen)
+
+			if got := b.allow(); got != tt.wantAllow {
+				t.Errorf("allow = %v, want %v", got, tt.wantAllow)
+			}
+			if b.state != tt.wantState {
+				t.Errorf("state = %d, want %d", b.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     error
+		wantState int
+		wantAllow bool
+	}{
+		{"succeeds", nil, breakerClosed, true},
+		{"fails", errors.New("publish failed"), breakerOpen, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &circuitBreaker{state: breakerOpen, openedAt: time.Now().Add(-breakerCooldown)}
+			if !b.allow() {
+				t.Fatal("allow = false after the cooldown")
+			}
+			if b.allow() {
+				t.Fatal("allow = true while the probe is in flight")
+			}
+			b.record(tt.probe)
+
+			if got := b.allow(); got != tt.wantAllow {
+				t.Errorf("allow = %v, want %v", got, tt.wantAllow)
+			}
+			if b.state != tt.wantState {
+				t.Errorf("state = %d, want %d", b.state, tt.wantState)
+			}
+		})
+	}
+}
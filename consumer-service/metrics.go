@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"consumer-service/config"
+
+	"common/tracing"
+)
+
+var (
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_consumed_total",
+		Help: "Messages received from RabbitMQ by queue.",
+	}, []string{"queue"})
+
+	messagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_failed_total",
+		Help: "Messages that could not be processed by queue and reason.",
+	}, []string{"queue", "reason"})
+
+	messagesDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_dead_lettered_total",
+		Help: "Messages sent to the dead-letter queue by source queue.",
+	}, []string{"queue"})
+
+	messageProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rabbitmq_message_processing_duration_seconds",
+		Help:    "Time taken to process a message by queue.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"queue"})
+
+	messagesSpilled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_spilled_total",
+		Help: "Publishes kept on disk because RabbitMQ could not take them, by exchange.",
+	}, []string{"exchange"})
+
+	spillReplayed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_spill_replayed_total",
+		Help: "Spilled publishes sent again once RabbitMQ recovered, by exchange.",
+	}, []string{"exchange"})
+
+	publishBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rabbitmq_publish_breaker_state",
+		Help: "State of the publish circuit breaker: 0 closed, 1 open, 2 half-open.",
+	})
+
+	mysqlOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mysql_operation_duration_seconds",
+		Help:    "Latency of MySQL statements by operation and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	mongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongo_operation_duration_seconds",
+		Help:    "Latency of MongoDB commands by command name and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command", "result"})
+)
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execMySQL runs a statement in a child span and records its latency under
+// operation.
+func execMySQL(ctx context.Context, e execer, operation, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "mysql "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mysql"), attribute.String("db.operation.name", operation)))
+	defer span.End()
+
+	start := time.Now()
+	result, err := e.ExecContext(ctx, query, args...)
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	mysqlOperationDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+	return result, err
+}
+
+// mongoMonitor returns a command monitor that times every MongoDB command.
+func mongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// serveMetrics exposes the Prometheus metrics and the health endpoints in
+// the background.
+func serveMetrics() *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", checker.Healthz)
+	mux.HandleFunc("/readyz", checker.Readyz)
+	server := &http.Server{Addr: config.GetMetricsAddr(), Handler: mux}
+	go func() {
+		log.Printf("Serving metrics on %s", server.Addr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	return server
+}
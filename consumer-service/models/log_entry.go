@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// LogEntry is the structured message written to the logging queue. Fields
+// holds event specific details that do not fit the fixed fields.
+type LogEntry struct {
+	Time          time.Time              `json:"time"`
+	Service       string                 `json:"service"`
+	Level         string                 `json:"level"`
+	Message       string                 `json:"message"`
+	CorrelationID string                 `json:"correlationid,omitempty"`
+	ItemCode      string                 `json:"itemcode,omitempty"`
+	EventType     string                 `json:"eventtype,omitempty"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+}
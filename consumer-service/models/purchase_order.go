@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type PurchaseOrderLine struct {
+	ItemCode         string  `json:"itemcode" bson:"itemcode"`
+	Quantity         int     `json:"quantity" bson:"quantity"`
+	ReceivedQuantity int     `json:"receivedquantity" bson:"receivedquantity"`
+	CostPrice        float64 `json:"costprice" bson:"costprice"`
+}
+
+type PurchaseOrder struct {
+	POID       string              `json:"poid" bson:"poid"`
+	StoreID    string              `json:"storeid" bson:"storeid"`
+	SupplierID string              `json:"supplierid" bson:"supplierid"`
+	Status     string              `json:"status" bson:"status"`
+	Lines      []PurchaseOrderLine `json:"lines" bson:"lines"`
+	Total      float64             `json:"total" bson:"total"`
+	CreatedAt  time.Time           `json:"createdat" bson:"createdat"`
+	SentAt     *time.Time          `json:"sentat,omitempty" bson:"sentat,omitempty"`
+	ClosedAt   *time.Time          `json:"closedat,omitempty" bson:"closedat,omitempty"`
+	Version    int                 `json:"version" bson:"version"`
+}
+
+// PurchaseOrderEvent is published by product-service on every purchase
+// order state change.
+type PurchaseOrderEvent struct {
+	PurchaseOrder  PurchaseOrder `json:"purchaseorder"`
+	PreviousStatus string        `json:"previousstatus,omitempty"`
+}
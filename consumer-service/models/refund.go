@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type RefundLine struct {
+	ItemCode   string  `json:"itemcode" bson:"itemcode"`
+	Quantity   int     `json:"quantity" bson:"quantity"`
+	ReasonCode string  `json:"reasoncode" bson:"reasoncode"`
+	UnitPrice  float64 `json:"unitprice" bson:"unitprice"`
+	Amount     float64 `json:"amount" bson:"amount"`
+}
+
+type Refund struct {
+	RefundID    string       `json:"refundid" bson:"refundid"`
+	StoreID     string       `json:"storeid" bson:"storeid"`
+	ReceiptNo   string       `json:"receiptno" bson:"receiptno"`
+	Lines       []RefundLine `json:"lines" bson:"lines"`
+	Total       float64      `json:"total" bson:"total"`
+	Status      string       `json:"status" bson:"status"`
+	RequestedBy string       `json:"requestedby" bson:"requestedby"`
+	ApprovedBy  string       `json:"approvedby,omitempty" bson:"approvedby,omitempty"`
+	CreatedAt   time.Time    `json:"createdat" bson:"createdat"`
+	CompletedAt *time.Time   `json:"completedat,omitempty" bson:"completedat,omitempty"`
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+
+	"common/rabbitmq"
+)
+
+const (
+	// spillMaxBytes caps the spill file; once it is full, publishes that
+	// fail are returned to the caller instead.
+	spillMaxBytes = 64 << 20
+	// spillReplayInterval is how often spilled messages are sent again.
+	spillReplayInterval = 10 * time.Second
+)
+
+var errSpillFull = errors.New("spill buffer full")
+
+// spilledMessage is a publish kept on disk until the broker takes it.
+type spilledMessage struct {
+	Exchange      string                 `json:"exchange"`
+	RoutingKey    string                 `json:"routingkey"`
+	ContentType   string                 `json:"contenttype,omitempty"`
+	CorrelationID string                 `json:"correlationid,omitempty"`
+	MessageID     string                 `json:"messageid,omitempty"`
+	Headers       map[string]interface{} `json:"headers,omitempty"`
+	Body          []byte                 `json:"body"`
+	SpilledAt     time.Time              `json:"spilledat"`
+}
+
+func (m spilledMessage) publishing() amqp091.Publishing {
+	return amqp091.Publishing{
+		ContentType:   m.ContentType,
+		CorrelationId: m.CorrelationID,
+		MessageId:     m.MessageID,
+		Headers:       amqp091.Table(m.Headers),
+		Body:          m.Body,
+	}
+}
+
+// spillBuffer keeps the publishes the broker could not take in an
+// append-only NDJSON file and sends them again once it recovers, so a broker
+// outage delays log entries and dead letters instead of losing them.
+type spillBuffer struct {
+	mu   sync.Mutex
+	path string
+	// replaying holds the batch being sent again. It is left in place by a
+	// crash and picked up by the next replay.
+	replaying string
+}
+
+func newSpillBuffer(dir string) (*spillBuffer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &spillBuffer{
+		path:      filepath.Join(dir, "pending.ndjson"),
+		replaying: filepath.Join(dir, "replaying.ndjson"),
+	}, nil
+}
+
+// add appends a publish to the spill file.
+func (s *spillBuffer) add(exchange, routingKey string, msg amqp091.Publishing) error {
+	line, err := json.Marshal(spilledMessage{
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		ContentType:   msg.ContentType,
+		CorrelationID: msg.CorrelationId,
+		MessageID:     msg.MessageId,
+		Headers:       msg.Headers,
+		Body:          msg.Body,
+		SpilledAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.append(append(line, '\n'))
+}
+
+// append writes data to the spill file and syncs it. The caller holds mu.
+func (s *spillBuffer) append(data []byte) error {
+	if info, err := os.Stat(s.path); err == nil && info.Size()+int64(len(data)) > spillMaxBytes {
+		return errSpillFull
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	// The message is only safe once it is on disk
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// run sends the spilled messages again every spillReplayInterval until ctx
+// is done, then closes done.
+func (s *spillBuffer) run(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(spillReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.replay(ctx); err != nil {
+			log.Printf("Failed to replay spilled messages: %v", err)
+		}
+	}
+}
+
+// replay moves the spill file aside and publishes its messages in order.
+// When a publish fails, the messages left are written back to the batch,
+// which the next replay resumes before taking newer spills.
+func (s *spillBuffer) replay(ctx context.Context) error {
+	s.mu.Lock()
+	if _, err := os.Stat(s.replaying); errors.Is(err, os.ErrNotExist) {
+		err = os.Rename(s.path, s.replaying)
+		if errors.Is(err, os.ErrNotExist) {
+			s.mu.Unlock()
+			return nil
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+
+	data, err := os.ReadFile(s.replaying)
+	if err != nil {
+		return err
+	}
+
+	sent, kept := 0, 0
+	var rest bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), spillMaxBytes)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if kept > 0 {
+			rest.Write(line)
+			rest.WriteByte('\n')
+			kept++
+			continue
+		}
+
+		var m spilledMessage
+		if err := json.Unmarshal(line, &m); err != nil {
+			log.Printf("Dropping unreadable spilled message: %v", err)
+			continue
+		}
+		err := tryPublish(ctx, m.Exchange, m.RoutingKey, m.publishing())
+		switch {
+		case err == nil:
+			sent++
+			spillReplayed.WithLabelValues(m.Exchange).Inc()
+		case errors.Is(err, rabbitmq.ErrUnroutable):
+			// Sending it again will not help
+			log.Printf("Dropping spilled message to %s with routing key %q: %v", m.Exchange, m.RoutingKey, err)
+		default:
+			rest.Write(line)
+			rest.WriteByte('\n')
+			kept++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if sent > 0 {
+		log.Printf("Replayed %d spilled messages", sent)
+	}
+
+	if kept == 0 {
+		return os.Remove(s.replaying)
+	}
+	tmp := s.replaying + ".tmp"
+	if err := os.WriteFile(tmp, rest.Bytes(), 0644); err != nil {
+		return fmt.Errorf("keep %d unsent messages: %w", kept, err)
+	}
+	return os.Rename(tmp, s.replaying)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// readSpilled returns the messages in an NDJSON spill file, in order.
+func readSpilled(t *testing.T, path string) []spilledMessage {
+	t.Helper()
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var messages []spilledMessage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var m spilledMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("unreadable spilled message %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, m)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// routingKeys returns the routing keys of messages, in order.
+func routingKeys(messages []spilledMessage) []string {
+	var keys []string
+	for _, m := range messages {
+		keys = append(keys, m.RoutingKey)
+	}
+	return keys
+}
+
+func TestSpillBufferAdd(t *testing.T) {
+	s, err := newSpillBuffer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := amqp091.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: "request-1",
+		Headers:       amqp091.Table{"x-tenant-id": "tenant-a"},
+		Body:          []byte(`{"itemcode":"A1"}`),
+	}
+	for _, key := range []string{"logging.info", "product.dlq"} {
+		if err := s.add("error_exchange", key, msg); err != nil {
+			t.Fatalf("add %s: %v", key, err)
+		}
+	}
+
+	spilled := readSpilled(t, s.path)
+	if got, want := routingKeys(spilled), []string{"logging.info", "product.dlq"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("spilled = %q, want %q", got, want)
+	}
+	got := spilled[0].publishing()
+	if got.ContentType != msg.ContentType || got.CorrelationId != msg.CorrelationId ||
+		got.Headers["x-tenant-id"] != "tenant-a" || string(got.Body) != string(msg.Body) {
+		t.Errorf("publishing = %+v, want %+v", got, msg)
+	}
+	if spilled[0].SpilledAt.IsZero() {
+		t.Error("spilledat is not set")
+	}
+}
+
+func TestSpillBufferFull(t *testing.T) {
+	s, err := newSpillBuffer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(s.path, spillMaxBytes-1); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.add("error_exchange", "logging.info", amqp091.Publishing{Body: []byte("entry")})
+	if !errors.Is(err, errSpillFull) {
+		t.Errorf("add = %v, want %v", err, errSpillFull)
+	}
+}
+
+func TestSpillBufferReplayKeepsUnsent(t *testing.T) {
+	// With the breaker open nothing reaches the broker, so every message
+	// has to be kept, in order, for the next replay.
+	saved := breaker
+	breaker = &circuitBreaker{state: breakerOpen, openedAt: time.Now()}
+	defer func() { breaker = saved }()
+
+	tests := []struct {
+		name string
+		// batch is left over from an earlier replay, pending is spilled
+		// since.
+		batch   string
+		pending []string
+		want    []string
+		// wantPending stays in the spill file until the batch is sent.
+		wantPending []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "pending moves to batch",
+			pending: []string{"logging.info", "logging.error"},
+			want:    []string{"logging.info", "logging.error"},
+		},
+		{
+			name:        "batch first",
+			batch:       `{"exchange":"error_exchange","routingkey":"product.dlq","body":null}` + "\n",
+			pending:     []string{"logging.info"},
+			want:        []string{"product.dlq"},
+			wantPending: []string{"logging.info"},
+		},
+		{
+			name:  "unreadable line dropped",
+			batch: "not json\n" + `{"exchange":"error_exchange","routingkey":"product.dlq","body":null}` + "\n",
+			want:  []string{"product.dlq"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSpillBuffer(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.batch != "" {
+				if err := os.WriteFile(s.replaying, []byte(tt.batch), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, key := range tt.pending {
+				if err := s.add("error_exchange", key, amqp091.Publishing{Body: []byte("entry")}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.replay(context.Background()); err != nil {
+				t.Fatalf("replay: %v", err)
+			}
+			if got := routingKeys(readSpilled(t, s.replaying)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batch = %q, want %q", got, tt.want)
+			}
+			if got := routingKeys(readSpilled(t, s.path)); !reflect.DeepEqual(got, tt.wantPending) {
+				t.Errorf("pending = %q, want %q", got, tt.wantPending)
+			}
+		})
+	}
+}
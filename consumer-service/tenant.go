@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// defaultSchema is the MySQL schema of the default tenant. Every other
+// tenant gets its own schema named after it.
+const defaultSchema = "order-service"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,32}$`)
+
+// projectionTables are created in every tenant schema on first use. The
+// product table of the default schema predates them and already exists.
+var projectionTables = []struct {
+	name    string
+	columns string
+}{
+	{"product", `
+        productId VARCHAR(64) NOT NULL PRIMARY KEY,
+        productName VARCHAR(255) NOT NULL`},
+	{"refund", `
+        refundId VARCHAR(64) NOT NULL PRIMARY KEY,
+        storeId VARCHAR(64) NOT NULL,
+        receiptNo VARCHAR(64) NOT NULL,
+        total DECIMAL(15,2) NOT NULL,
+        requestedBy VARCHAR(64) NOT NULL,
+        approvedBy VARCHAR(64) NOT NULL DEFAULT '',
+        completedAt DATETIME NOT NULL,
+        INDEX idx_refund_receipt (storeId, receiptNo)`},
+	{"refund_line", `
+        id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+        refundId VARCHAR(64) NOT NULL,
+        productId VARCHAR(64) NOT NULL,
+        quantity INT NOT NULL,
+        reasonCode VARCHAR(32) NOT NULL,
+        unitPrice DECIMAL(15,2) NOT NULL,
+        amount DECIMAL(15,2) NOT NULL,
+        INDEX idx_refund_line_refund (refundId)`},
+	{"store", `
+        storeId VARCHAR(64) NOT NULL PRIMARY KEY,
+        storeName VARCHAR(255) NOT NULL,
+        address VARCHAR(255) NOT NULL DEFAULT '',
+        active BOOLEAN NOT NULL DEFAULT TRUE`},
+	{"store_product", `
+        storeId VARCHAR(64) NOT NULL,
+        productId VARCHAR(64) NOT NULL,
+        price DECIMAL(15,2) NULL,
+        available BOOLEAN NOT NULL DEFAULT TRUE,
+        PRIMARY KEY (storeId, productId)`},
+	{"purchase_order", `
+        poId VARCHAR(64) NOT NULL PRIMARY KEY,
+        storeId VARCHAR(64) NOT NULL,
+        supplierId VARCHAR(64) NOT NULL,
+        status VARCHAR(32) NOT NULL,
+        total DECIMAL(15,2) NOT NULL,
+        createdAt DATETIME NOT NULL,
+        sentAt DATETIME NULL,
+        closedAt DATETIME NULL,
+        version INT NOT NULL,
+        INDEX idx_purchase_order_store (storeId, status)`},
+	{"purchase_order_line", `
+        id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+        poId VARCHAR(64) NOT NULL,
+        productId VARCHAR(64) NOT NULL,
+        quantity INT NOT NULL,
+        receivedQuantity INT NOT NULL,
+        costPrice DECIMAL(15,2) NOT NULL,
+        INDEX idx_purchase_order_line_po (poId)`},
+}
+
+// provisionedSchemas remembers the schemas whose tables have been created.
+var provisionedSchemas sync.Map
+
+func tenantSchema(tenantID string) string {
+	if tenantID == "" {
+		return defaultSchema
+	}
+	return defaultSchema + "_" + tenantID
+}
+
+// table returns the qualified name of a projection table in the tenant's schema.
+func table(tenantID, name string) string {
+	return fmt.Sprintf("`%s`.`%s`", tenantSchema(tenantID), name)
+}
+
+// ensureTenantSchema creates the schema and projection tables of a tenant
+// the first time a message for it is processed.
+func ensureTenantSchema(ctx context.Context, tenantID string) error {
+	if tenantID != "" && !tenantIDPattern.MatchString(tenantID) {
+		return fmt.Errorf("%w: invalid tenant ID %q", errMalformedMessage, tenantID)
+	}
+
+	schema := tenantSchema(tenantID)
+	if _, ok := provisionedSchemas.Load(schema); ok {
+		return nil
+	}
+
+	if _, err := execMySQL(ctx, db, "create_schema", fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", schema)); err != nil {
+		return fmt.Errorf("could not create schema %s: %v", schema, err)
+	}
+	for _, t := range projectionTables {
+		statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s\n    )", table(tenantID, t.name), t.columns)
+		if _, err := execMySQL(ctx, db, "create_table", statement); err != nil {
+			return fmt.Errorf("could not create table %s: %v", table(tenantID, t.name), err)
+		}
+	}
+
+	provisionedSchemas.Store(schema, true)
+	return nil
+}
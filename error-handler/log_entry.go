@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"common/rabbitmq"
+	"common/requestid"
+	"common/topology"
+	"common/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// LogEntry is the structured message written to the logging queue.
+type LogEntry struct {
+	Time          time.Time              `json:"time"`
+	Service       string                 `json:"service"`
+	Level         string                 `json:"level"`
+	Message       string                 `json:"message"`
+	CorrelationID string                 `json:"correlationid,omitempty"`
+	ItemCode      string                 `json:"itemcode,omitempty"`
+	EventType     string                 `json:"eventtype,omitempty"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+}
+
+// publishLog writes entry to the logging queue for tenantID, routed by its
+// level. Failures are only logged locally.
+func publishLog(ctx context.Context, rabbitMQ *rabbitmq.Manager, tenantID string, entry LogEntry) {
+	entry.Time = time.Now().UTC()
+	entry.Service = "error-handler"
+
+	headers := amqp091.Table{}
+	if tenantID != "" {
+		headers["x-tenant-id"] = tenantID
+	}
+	if requestID := requestid.FromContext(ctx); requestID != "" {
+		headers[requestid.Header] = requestID
+		if entry.CorrelationID == "" {
+			entry.CorrelationID = requestID
+		}
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal log entry: %s", err)
+		return
+	}
+	spanCtx, span := tracing.StartPublish(ctx, topology.ErrorExchange, topology.LoggingKey(entry.Level))
+	tracing.Inject(spanCtx, headers)
+	defer span.End()
+	err = rabbitMQ.Publish(ctx, topology.ErrorExchange, topology.LoggingKey(entry.Level), true, amqp091.Publishing{
+		ContentType: "application/json",
+		Headers:     headers,
+		Body:        body,
+	})
+	if err != nil {
+		log.Printf("Failed to publish log entry: %s", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+
+	"common/requestid"
+	"common/topology"
+)
+
+func TestOriginalRoutingKey(t *testing.T) {
+	death := func(keys ...interface{}) amqp091.Table {
+		return amqp091.Table{"queue": topology.ProductUpdateQueue, "routing-keys": keys}
+	}
+	tests := []struct {
+		name    string
+		headers amqp091.Table
+		want    string
+	}{
+		{"none", nil, ""},
+		{"recorded by the consumer", amqp091.Table{"x-original-routing-key": topology.KeyStoreProductUpdate}, topology.KeyStoreProductUpdate},
+		{"delivery limit reached", amqp091.Table{"x-death": []interface{}{death(topology.KeyProductUpdate)}}, topology.KeyProductUpdate},
+		{"dead-lettered again", amqp091.Table{"x-death": []interface{}{death(topology.KeyDeadLetter), death(topology.KeyProductInsert)}}, topology.KeyProductInsert},
+		{
+			name: "consumer header wins",
+			headers: amqp091.Table{
+				"x-original-routing-key": topology.KeyStoreProductUpdate,
+				"x-death":                []interface{}{death(topology.KeyProductUpdate)},
+			},
+			want: topology.KeyStoreProductUpdate,
+		},
+		{"no routing keys", amqp091.Table{"x-death": []interface{}{death()}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originalRoutingKey(tt.headers); got != tt.want {
+				t.Errorf("originalRoutingKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleDeadLetter(t *testing.T) {
+	tests := []struct {
+		name        string
+		routingKey  string
+		body        string
+		wantDeleted []string
+	}{
+		{"product insert", topology.KeyProductInsert, `{"itemcode":"A1","name":"Tea","price":1.5}`, []string{"A1"}},
+		{"product update", topology.KeyProductUpdate, `{"itemcode":"A1","name":"Tea","price":1.5}`, []string{"A1"}},
+		// A failed price override must not remove the master product
+		{"store product", topology.KeyStoreProductUpdate, `{"storeid":"S1","itemcode":"A1","price":1.2}`, nil},
+		{"unknown type", "", `{"itemcode":"A1"}`, nil},
+		{"product without itemcode", topology.KeyProductUpdate, `{"name":"Tea"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []LogEntry
+			report := func(ctx context.Context, tenantID string, entry LogEntry) {
+				if tenantID != "t1" {
+					t.Errorf("reported for tenant %q, want t1", tenantID)
+				}
+				if requestID := requestid.FromContext(ctx); requestID != "r1" {
+					t.Errorf("reported for request %q, want r1", requestID)
+				}
+				reported = append(reported, entry)
+			}
+			var deleted []string
+			deleteProduct := func(_ context.Context, tenantID, itemCode string) error {
+				if tenantID != "t1" {
+					t.Errorf("deleted for tenant %q, want t1", tenantID)
+				}
+				deleted = append(deleted, itemCode)
+				return nil
+			}
+
+			handleDeadLetter(amqp091.Delivery{
+				Exchange:   topology.ErrorExchange,
+				RoutingKey: topology.KeyDeadLetter,
+				Headers:    amqp091.Table{"x-tenant-id": "t1", requestid.Header: "r1", "x-original-routing-key": tt.routingKey},
+				Body:       []byte(tt.body),
+			}, topology.ProductDLQ, report, deleteProduct)
+
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+			if len(reported) != 1 || reported[0].Fields["routingkey"] != tt.routingKey {
+				t.Errorf("reported %+v, want one entry for %q", reported, tt.routingKey)
+			}
+		})
+	}
+}
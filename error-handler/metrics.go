@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+
+	"common/health"
+)
+
+var (
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_consumed_total",
+		Help: "Messages received from RabbitMQ by queue.",
+	}, []string{"queue"})
+
+	messagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_failed_total",
+		Help: "Messages that could not be processed by queue and reason.",
+	}, []string{"queue", "reason"})
+
+	// deadLettersHandled counts dead-lettered messages by the queue they
+	// were originally routed with.
+	deadLettersHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_dead_lettered_total",
+		Help: "Dead-lettered messages handled by original routing key.",
+	}, []string{"routing_key"})
+
+	mongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongo_operation_duration_seconds",
+		Help:    "Latency of MongoDB commands by command name and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command", "result"})
+)
+
+// mongoMonitor returns a command monitor that times every MongoDB command.
+func mongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// serveMetrics exposes the Prometheus metrics and the health endpoints of
+// checker on addr in the background.
+func serveMetrics(addr string, checker *health.Checker) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", checker.Healthz)
+	mux.HandleFunc("/readyz", checker.Readyz)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Printf("Serving metrics on %s", addr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	return server
+}
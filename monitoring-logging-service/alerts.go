@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// alertConfig is the alert rules file.
+type alertConfig struct {
+	Rules     []alertRule      `yaml:"rules"`
+	Notifiers []notifierConfig `yaml:"notifiers"`
+}
+
+// alertRule fires when more than Threshold matching entries arrive within
+// Window. Entries are counted separately per value of the GroupBy fields,
+// and a group that fired stays quiet for Cooldown.
+type alertRule struct {
+	Name      string        `yaml:"name"`
+	Match     alertMatch    `yaml:"match"`
+	Threshold int           `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	Cooldown  time.Duration `yaml:"cooldown"`
+	GroupBy   []string      `yaml:"groupby"`
+	Notify    []string      `yaml:"notify"`
+}
+
+// alertMatch selects the entries a rule counts. Message matches a
+// case-insensitive substring, Fields the string value of entry fields, and
+// every other field exactly. Empty fields match everything.
+type alertMatch struct {
+	Level     string            `yaml:"level"`
+	Service   string            `yaml:"service"`
+	EventType string            `yaml:"eventtype"`
+	ItemCode  string            `yaml:"itemcode"`
+	Tenant    string            `yaml:"tenant"`
+	Message   string            `yaml:"message"`
+	Fields    map[string]string `yaml:"fields"`
+}
+
+func (m alertMatch) matches(entry LogEntry) bool {
+	if (m.Level != "" && m.Level != entry.Level) ||
+		(m.Service != "" && m.Service != entry.Service) ||
+		(m.EventType != "" && m.EventType != entry.EventType) ||
+		(m.ItemCode != "" && m.ItemCode != entry.ItemCode) ||
+		(m.Tenant != "" && m.Tenant != entry.Tenant) {
+		return false
+	}
+	if m.Message != "" && !strings.Contains(strings.ToLower(entry.Message), strings.ToLower(m.Message)) {
+		return false
+	}
+	for name, value := range m.Fields {
+		if fmt.Sprint(entry.Fields[name]) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// groupKey returns the value of the rule's GroupBy fields for entry.
+func (r alertRule) groupKey(entry LogEntry) string {
+	values := make([]string, len(r.GroupBy))
+	for i, field := range r.GroupBy {
+		switch field {
+		case "tenant":
+			values[i] = entry.Tenant
+		case "service":
+			values[i] = entry.Service
+		case "itemcode":
+			values[i] = entry.ItemCode
+		case "eventtype":
+			values[i] = entry.EventType
+		default:
+			values[i] = fmt.Sprint(entry.Fields[field])
+		}
+		values[i] = field + "=" + values[i]
+	}
+	return strings.Join(values, ",")
+}
+
+// loadAlertConfig reads and checks the rules file at path.
+func loadAlertConfig(path string) (alertConfig, error) {
+	var cfg alertConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg alertConfig) validate() error {
+	var problems []error
+	notifiers := make(map[string]bool)
+	for _, n := range cfg.Notifiers {
+		if n.Name == "" || notifiers[n.Name] {
+			problems = append(problems, fmt.Errorf("notifier %q: name must be set and unique", n.Name))
+		}
+		notifiers[n.Name] = true
+		if err := n.validate(); err != nil {
+			problems = append(problems, fmt.Errorf("notifier %q: %w", n.Name, err))
+		}
+	}
+
+	rules := make(map[string]bool)
+	for _, r := range cfg.Rules {
+		if r.Name == "" || rules[r.Name] {
+			problems = append(problems, fmt.Errorf("rule %q: name must be set and unique", r.Name))
+		}
+		rules[r.Name] = true
+		if r.Threshold < 0 {
+			problems = append(problems, fmt.Errorf("rule %q: threshold must not be negative", r.Name))
+		}
+		if r.Window <= 0 {
+			problems = append(problems, fmt.Errorf("rule %q: window must be positive", r.Name))
+		}
+		if r.Cooldown < 0 {
+			problems = append(problems, fmt.Errorf("rule %q: cooldown must not be negative", r.Name))
+		}
+		if r.Match.Level != "" && !logLevels[r.Match.Level] {
+			problems = append(problems, fmt.Errorf("rule %q: unknown level %q", r.Name, r.Match.Level))
+		}
+		if len(r.Notify) == 0 {
+			problems = append(problems, fmt.Errorf("rule %q: notify must name at least one notifier", r.Name))
+		}
+		for _, name := range r.Notify {
+			if !notifiers[name] {
+				problems = append(problems, fmt.Errorf("rule %q: unknown notifier %q", r.Name, name))
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// alert is a rule that fired.
+type alert struct {
+	Rule      string    `json:"rule"`
+	Group     string    `json:"group,omitempty"`
+	Count     int       `json:"count"`
+	Threshold int       `json:"threshold"`
+	Window    string    `json:"window"`
+	FiredAt   time.Time `json:"firedat"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Service   string    `json:"service"`
+	Message   string    `json:"message"`
+	notify    []string
+}
+
+func (a alert) summary() string {
+	return fmt.Sprintf("Alert %s: %d matching log entries within %s (threshold %d)", a.Rule, a.Count, a.Window, a.Threshold)
+}
+
+type alertWindow struct {
+	seen      []time.Time
+	lastFired time.Time
+	// expires is when the window holds nothing its rule still needs: no
+	// entry within the rule's window and no cooldown running.
+	expires time.Time
+}
+
+// alertPruneInterval is how often evaluate drops expired windows, so groups
+// that stop logging do not pile up.
+const alertPruneInterval = time.Minute
+
+// alertEngine counts matching entries per rule and group and reports the
+// rules that fire.
+type alertEngine struct {
+	mu      sync.Mutex
+	rules   []alertRule
+	windows map[string]*alertWindow
+	now     func() time.Time
+	pruned  time.Time
+}
+
+func newAlertEngine(rules []alertRule) *alertEngine {
+	return &alertEngine{rules: rules, windows: make(map[string]*alertWindow), now: time.Now}
+}
+
+// evaluate counts entry against every rule and returns the alerts it fires.
+// A group that fires starts counting again from zero.
+func (e *alertEngine) evaluate(entry LogEntry) []alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if now.Sub(e.pruned) >= alertPruneInterval {
+		e.prune(now)
+	}
+	var fired []alert
+	for _, rule := range e.rules {
+		if !rule.Match.matches(entry) {
+			continue
+		}
+		group := rule.groupKey(entry)
+		key := rule.Name + "|" + group
+		window, ok := e.windows[key]
+		if !ok {
+			window = &alertWindow{}
+			e.windows[key] = window
+		}
+
+		window.seen = append(window.seen, now)
+		window.expires = now.Add(max(rule.Window, rule.Cooldown))
+		cutoff := now.Add(-rule.Window)
+		for len(window.seen) > 0 && !window.seen[0].After(cutoff) {
+			window.seen = window.seen[1:]
+		}
+
+		if len(window.seen) <= rule.Threshold {
+			continue
+		}
+		if !window.lastFired.IsZero() && now.Sub(window.lastFired) < rule.Cooldown {
+			continue
+		}
+		fired = append(fired, alert{
+			Rule:      rule.Name,
+			Group:     group,
+			Count:     len(window.seen),
+			Threshold: rule.Threshold,
+			Window:    rule.Window.String(),
+			FiredAt:   now.UTC(),
+			Tenant:    entry.Tenant,
+			Service:   entry.Service,
+			Message:   entry.Message,
+			notify:    rule.Notify,
+		})
+		window.lastFired = now
+		window.seen = nil
+	}
+	return fired
+}
+
+// prune drops the windows that expired by now.
+func (e *alertEngine) prune(now time.Time) {
+	for key, window := range e.windows {
+		if !window.expires.After(now) {
+			delete(e.windows, key)
+		}
+	}
+	e.pruned = now
+}
+
+// alerting evaluates the rules over consumed entries and dispatches the
+// alerts they fire. A nil alerting ignores everything.
+type alerting struct {
+	engine     *alertEngine
+	dispatcher *alertDispatcher
+}
+
+func newAlerting(cfg alertConfig) *alerting {
+	return &alerting{engine: newAlertEngine(cfg.Rules), dispatcher: newAlertDispatcher(cfg.Notifiers)}
+}
+
+func (a *alerting) observe(entry LogEntry) {
+	if a == nil {
+		return
+	}
+	for _, fired := range a.engine.evaluate(entry) {
+		a.dispatcher.dispatch(fired)
+	}
+}
+
+// close sends the alerts still queued, see alertDispatcher.close.
+func (a *alerting) close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	return a.dispatcher.close(ctx)
+}
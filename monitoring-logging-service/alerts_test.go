@@ -0,0 +1,284 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertMatch(t *testing.T) {
+	entry := LogEntry{
+		Level:     levelError,
+		Service:   "consumer-service",
+		EventType: "dlq.received",
+		ItemCode:  "A1",
+		Tenant:    "tenant-a",
+		Message:   "Could not insert product A1",
+		Fields:    map[string]interface{}{"category": "Beverages", "attempts": 3},
+	}
+	tests := []struct {
+		name  string
+		match alertMatch
+		want  bool
+	}{
+		{"empty", alertMatch{}, true},
+		{"every field", alertMatch{Level: levelError, Service: "consumer-service", EventType: "dlq.received", ItemCode: "A1", Tenant: "tenant-a"}, true},
+		{"other level", alertMatch{Level: levelWarn}, false},
+		{"other tenant", alertMatch{Tenant: "tenant-b"}, false},
+		{"message substring any case", alertMatch{Message: "could NOT insert"}, true},
+		{"other message", alertMatch{Message: "timeout"}, false},
+		{"string field", alertMatch{Fields: map[string]string{"category": "Beverages"}}, true},
+		{"number field", alertMatch{Fields: map[string]string{"attempts": "3"}}, true},
+		{"other field value", alertMatch{Fields: map[string]string{"category": "Snacks"}}, false},
+		{"missing field", alertMatch{Fields: map[string]string{"store": "S1"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match.matches(entry); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertGroupKey(t *testing.T) {
+	entry := LogEntry{Tenant: "tenant-a", ItemCode: "A1", Fields: map[string]interface{}{"store": "S1"}}
+	tests := []struct {
+		groupBy []string
+		want    string
+	}{
+		{nil, ""},
+		{[]string{"tenant"}, "tenant=tenant-a"},
+		{[]string{"tenant", "itemcode", "store"}, "tenant=tenant-a,itemcode=A1,store=S1"},
+	}
+	for _, tt := range tests {
+		if got := (alertRule{GroupBy: tt.groupBy}).groupKey(entry); got != tt.want {
+			t.Errorf("groupKey(%q) = %q, want %q", tt.groupBy, got, tt.want)
+		}
+	}
+}
+
+// step is an entry evaluated at an offset from the start of a test.
+type step struct {
+	at     time.Duration
+	entry  LogEntry
+	groups []string
+}
+
+func TestAlertEngine(t *testing.T) {
+	errorEntry := func(tenant string) LogEntry {
+		return LogEntry{Level: levelError, Service: "consumer-service", Tenant: tenant, Message: "failed"}
+	}
+	rule := alertRule{
+		Name:      "errors",
+		Match:     alertMatch{Level: levelError},
+		Threshold: 2,
+		Window:    time.Minute,
+		Cooldown:  5 * time.Minute,
+		GroupBy:   []string{"tenant"},
+		Notify:    []string{"ops"},
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "fires above threshold",
+			steps: []step{
+				{at: 0, entry: errorEntry("a")},
+				{at: time.Second, entry: errorEntry("a")},
+				{at: 2 * time.Second, entry: errorEntry("a"), groups: []string{"tenant=a"}},
+			},
+		},
+		{
+			name: "other entries ignored",
+			steps: []step{
+				{at: 0, entry: errorEntry("a")},
+				{at: time.Second, entry: LogEntry{Level: levelInfo, Tenant: "a"}},
+				{at: 2 * time.Second, entry: LogEntry{Level: levelInfo, Tenant: "a"}},
+			},
+		},
+		{
+			name: "groups counted apart",
+			steps: []step{
+				{at: 0, entry: errorEntry("a")},
+				{at: time.Second, entry: errorEntry("b")},
+				{at: 2 * time.Second, entry: errorEntry("a")},
+				{at: 3 * time.Second, entry: errorEntry("b")},
+				{at: 4 * time.Second, entry: errorEntry("b"), groups: []string{"tenant=b"}},
+			},
+		},
+		{
+			name: "entries leave the window",
+			steps: []step{
+				{at: 0, entry: errorEntry("a")},
+				{at: 30 * time.Second, entry: errorEntry("a")},
+				{at: 61 * time.Second, entry: errorEntry("a")},
+				{at: 62 * time.Second, entry: errorEntry("a"), groups: []string{"tenant=a"}},
+			},
+		},
+		{
+			name: "quiet during cooldown",
+			steps: []step{
+				{at: 0, entry: errorEntry("a")},
+				{at: time.Second, entry: errorEntry("a")},
+				{at: 2 * time.Second, entry: errorEntry("a"), groups: []string{"tenant=a"}},
+				{at: 3 * time.Second, entry: errorEntry("a")},
+				{at: 4 * time.Second, entry: errorEntry("a")},
+				{at: 5 * time.Second, entry: errorEntry("a")},
+				{at: 5*time.Minute + time.Second, entry: errorEntry("a")},
+				{at: 5*time.Minute + 2*time.Second, entry: errorEntry("a")},
+				{at: 5*time.Minute + 3*time.Second, entry: errorEntry("a"), groups: []string{"tenant=a"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			var now time.Time
+			e := newAlertEngine([]alertRule{rule})
+			e.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = start.Add(s.at)
+				var groups []string
+				for _, a := range e.evaluate(s.entry) {
+					groups = append(groups, a.Group)
+					if a.Rule != rule.Name || a.Count != rule.Threshold+1 || !reflect.DeepEqual(a.notify, rule.Notify) {
+						t.Errorf("step %d: alert = %+v", i, a)
+					}
+				}
+				if !reflect.DeepEqual(groups, s.groups) {
+					t.Errorf("step %d: fired %q, want %q", i, groups, s.groups)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertEnginePrune(t *testing.T) {
+	rule := alertRule{Name: "errors", Match: alertMatch{Level: levelError}, Threshold: 10, Window: time.Minute, Cooldown: 5 * time.Minute, GroupBy: []string{"tenant"}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	e := newAlertEngine([]alertRule{rule})
+	e.now = func() time.Time { return now }
+
+	e.evaluate(LogEntry{Level: levelError, Tenant: "a"})
+	now = start.Add(4 * time.Minute)
+	e.evaluate(LogEntry{Level: levelError, Tenant: "b"})
+	if len(e.windows) != 2 {
+		t.Fatalf("windows = %d, want 2", len(e.windows))
+	}
+
+	// a expires once its cooldown could have run out, b is still needed
+	now = start.Add(5*time.Minute + time.Second)
+	e.evaluate(LogEntry{Level: levelInfo})
+	if _, ok := e.windows["errors|tenant=a"]; ok {
+		t.Error("window of tenant a was not pruned")
+	}
+	if _, ok := e.windows["errors|tenant=b"]; !ok {
+		t.Error("window of tenant b was pruned")
+	}
+}
+
+func TestLoadAlertConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		// wantErrors are substrings of the error, nil for none.
+		wantErrors []string
+	}{
+		{
+			name: "valid",
+			yaml: `
+rules:
+  - name: errors
+    match: {level: error}
+    threshold: 0
+    window: 1m
+    notify: [ops]
+notifiers:
+  - {name: ops, type: logfile, path: alerts.log}
+`,
+		},
+		{
+			name:       "unknown key",
+			yaml:       "rules:\n  - name: errors\n    treshold: 5\n",
+			wantErrors: []string{"field treshold not found"},
+		},
+		{
+			name: "rule problems",
+			yaml: `
+rules:
+  - name: errors
+    match: {level: fatal}
+    threshold: -1
+    window: 0s
+    cooldown: -1m
+    notify: [pager]
+  - name: errors
+    window: 1m
+notifiers:
+  - {name: ops, type: logfile, path: alerts.log}
+`,
+			wantErrors: []string{
+				`rule "errors": threshold must not be negative`,
+				`rule "errors": window must be positive`,
+				`rule "errors": cooldown must not be negative`,
+				`rule "errors": unknown level "fatal"`,
+				`rule "errors": unknown notifier "pager"`,
+				`rule "errors": name must be set and unique`,
+				`rule "errors": notify must name at least one notifier`,
+			},
+		},
+		{
+			name: "notifier problems",
+			yaml: `
+notifiers:
+  - {name: ops, type: logfile, path: alerts.log}
+  - {name: ops, type: logfile, path: other.log}
+  - {name: hook, type: webhook}
+`,
+			wantErrors: []string{
+				`notifier "ops": name must be set and unique`,
+				`notifier "hook": webhook needs url`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "alerts.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadAlertConfig(path)
+			if tt.wantErrors == nil {
+				if err != nil {
+					t.Fatalf("loadAlertConfig: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("loadAlertConfig = nil, want %q", tt.wantErrors)
+			}
+			for _, want := range tt.wantErrors {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertsExample(t *testing.T) {
+	cfg, err := loadAlertConfig("alerts.example.yaml")
+	if err != nil {
+		t.Fatalf("loadAlertConfig: %v", err)
+	}
+	if len(cfg.Rules) == 0 || len(cfg.Notifiers) == 0 {
+		t.Errorf("example has %d rules and %d notifiers", len(cfg.Rules), len(cfg.Notifiers))
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const archiveBatchSize = 10000
+
+// archiver copies expired log entries to compressed NDJSON files and then
+// marks them archived, which lets the TTL index delete them.
+type archiver struct {
+	collection *mongo.Collection
+	dir        string
+}
+
+// run archives expired entries every interval until ctx is done, then closes
+// done. A run in progress when ctx is done is finished rather than cut short,
+// so no batch is written without being marked archived.
+func (a *archiver) run(ctx context.Context, interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := a.archiveExpired(context.WithoutCancel(ctx))
+		if err != nil {
+			log.Printf("Failed to archive expired logs: %s", err)
+		} else if n > 0 {
+			log.Printf("Archived %d expired log entries to %s", n, a.dir)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveExpired archives every entry past its expiry time, one file per
+// batch, and returns how many were archived.
+func (a *archiver) archiveExpired(ctx context.Context) (int, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for {
+		filter := bson.D{
+			{Key: "expireat", Value: bson.D{{Key: "$lte", Value: time.Now().UTC()}}},
+			{Key: "archived", Value: bson.D{{Key: "$ne", Value: true}}},
+		}
+		opts := options.Find().SetSort(bson.D{{Key: "expireat", Value: 1}}).SetLimit(archiveBatchSize)
+		cursor, err := a.collection.Find(ctx, filter, opts)
+		if err != nil {
+			return total, err
+		}
+		var entries []LogEntry
+		if err := cursor.All(ctx, &entries); err != nil {
+			return total, err
+		}
+		if len(entries) == 0 {
+			return total, nil
+		}
+
+		if err := a.writeArchive(entries); err != nil {
+			return total, err
+		}
+
+		ids := make([]primitive.ObjectID, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.ID
+		}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "archived", Value: true}}}}
+		if _, err := a.collection.UpdateMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, update); err != nil {
+			return total, err
+		}
+		total += len(entries)
+		logEntriesArchived.Add(float64(len(entries)))
+
+		if len(entries) < archiveBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// writeArchive writes entries to a new gzipped NDJSON file. The file only
+// appears under its final name once it is completely on disk.
+func (a *archiver) writeArchive(entries []LogEntry) error {
+	name := fmt.Sprintf("logs-%s-%s.ndjson.gz", time.Now().UTC().Format("20060102T150405"), entries[0].ID.Hex())
+	path := filepath.Join(a.dir, name)
+	tmp, err := os.CreateTemp(a.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	encoder := json.NewEncoder(gz)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
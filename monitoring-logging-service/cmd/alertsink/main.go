@@ -0,0 +1,136 @@
+// Command alertsink is a local stand-in for the webhook and SMTP endpoints
+// alert notifiers deliver to. It accepts webhook posts and mail, and prints
+// everything it receives, so alert rules can be tried without real
+// infrastructure.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	outMu sync.Mutex
+	out   io.Writer = os.Stdout
+)
+
+func record(kind, body string) {
+	outMu.Lock()
+	defer outMu.Unlock()
+	fmt.Fprintf(out, "=== %s %s\n%s\n\n", time.Now().UTC().Format(time.RFC3339), kind, strings.TrimSpace(body))
+}
+
+func main() {
+	httpAddr := flag.String("http", ":9095", "address to accept webhook posts on")
+	smtpAddr := flag.String("smtp", ":2525", "address to accept mail on")
+	outPath := flag.String("out", "", "file to append received alerts to instead of stdout")
+	flag.Parse()
+
+	if *outPath != "" {
+		file, err := os.OpenFile(*outPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *outPath, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	listener, err := net.Listen("tcp", *smtpAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen for SMTP on %s: %v", *smtpAddr, err)
+	}
+	go serveSMTP(listener)
+	log.Printf("Accepting mail on %s", *smtpAddr)
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		record("webhook "+r.URL.Path, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	log.Printf("Accepting webhooks on %s", *httpAddr)
+	log.Fatal(http.ListenAndServe(*httpAddr, nil))
+}
+
+func serveSMTP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("SMTP accept: %v", err)
+			return
+		}
+		go handleSMTP(conn)
+	}
+}
+
+// handleSMTP speaks just enough SMTP for net/smtp.SendMail to deliver a
+// message: no TLS, no authentication.
+func handleSMTP(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 alertsink ESMTP ready")
+	var from string
+	var to []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 alertsink")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			from = strings.TrimSpace(line[len("MAIL FROM:"):])
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			to = append(to, strings.TrimSpace(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if strings.TrimRight(dataLine, "\r\n") == "." {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			record(fmt.Sprintf("mail from %s to %s", from, strings.Join(to, ", ")), data.String())
+			from, to = "", nil
+			reply("250 OK queued")
+		case command == "RSET":
+			from, to = "", nil
+			reply("250 OK")
+		case command == "NOOP":
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
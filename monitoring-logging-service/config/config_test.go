@@ -0,0 +1,65 @@
+package config
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestParseLogRetention(t *testing.T) {
+    const day = 24 * time.Hour
+    tests := []struct {
+        name    string
+        value   string
+        want    map[string]time.Duration
+        wantErr bool
+    }{
+        {
+            name:  "defaults",
+            value: "",
+            want:  map[string]time.Duration{"debug": 3 * day, "info": 14 * day, "warn": 30 * day, "error": 90 * day},
+        },
+        {
+            name:  "days and durations over defaults",
+            value: "debug=72h, ERROR=30d",
+            want:  map[string]time.Duration{"debug": 72 * time.Hour, "info": 14 * day, "warn": 30 * day, "error": 30 * day},
+        },
+        {
+            name:  "empty pairs skipped",
+            value: "info=7d,,",
+            want:  map[string]time.Duration{"debug": 3 * day, "info": 7 * day, "warn": 30 * day, "error": 90 * day},
+        },
+        {name: "not a pair", value: "debug", wantErr: true},
+        {name: "unknown level", value: "fatal=30d", wantErr: true},
+        {name: "invalid duration", value: "info=soon", wantErr: true},
+        {name: "invalid days", value: "info=xd", wantErr: true},
+        {name: "zero", value: "info=0d", wantErr: true},
+        {name: "negative", value: "info=-1h", wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseLogRetention(tt.value)
+            if tt.wantErr {
+                if err == nil {
+                    t.Errorf("parseLogRetention(%q) = %v, want an error", tt.value, got)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("parseLogRetention(%q): %v", tt.value, err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("parseLogRetention(%q) = %v, want %v", tt.value, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseLogRetentionKeepsDefaults(t *testing.T) {
+    if _, err := parseLogRetention("debug=1h"); err != nil {
+        t.Fatal(err)
+    }
+    if defaultLogRetention["debug"] != 3*24*time.Hour {
+        t.Errorf("default debug retention changed to %s", defaultLogRetention["debug"])
+    }
+}
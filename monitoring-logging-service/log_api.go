@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"common/health"
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+
+	// tailBuffer is how many entries a slow tail client may fall behind
+	// before entries are dropped for it.
+	tailBuffer         = 256
+	tailKeepAlive      = 15 * time.Second
+	searchQueryTimeout = 30 * time.Second
+)
+
+// logTail fans newly stored entries out to the connected tail clients.
+type logTail struct {
+	mu          sync.Mutex
+	subscribers map[chan LogEntry]logFilter
+	// closed ends the tail streams when the server shuts down, which would
+	// otherwise wait for the clients to hang up.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newLogTail() *logTail {
+	return &logTail{subscribers: make(map[chan LogEntry]logFilter), closed: make(chan struct{})}
+}
+
+func (t *logTail) close() {
+	t.closeOnce.Do(func() { close(t.closed) })
+}
+
+func (t *logTail) subscribe(filter logFilter) chan LogEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries := make(chan LogEntry, tailBuffer)
+	t.subscribers[entries] = filter
+	return entries
+}
+
+func (t *logTail) unsubscribe(entries chan LogEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.subscribers, entries)
+}
+
+// publish hands entry to every subscriber whose filter matches, without
+// waiting for slow ones.
+func (t *logTail) publish(entry LogEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for entries, filter := range t.subscribers {
+		if !filter.matches(entry) {
+			continue
+		}
+		select {
+		case entries <- entry:
+		default:
+		}
+	}
+}
+
+// logAPI serves log search and live tail over HTTP, next to the metrics
+// and health endpoints. Every log request carries a bearer token from
+// tokens, which maps it to the tenant it may read or "*" for all of them.
+type logAPI struct {
+	collection *mongo.Collection
+	tail       *logTail
+	checker    *health.Checker
+	tokens     map[string]string
+}
+
+// allTenants is the token scope that may read every tenant's entries.
+const allTenants = "*"
+
+// filter reads the request's filter and narrows it to the tenant its token
+// may read. It answers the request itself when that fails.
+func (api *logAPI) filter(w http.ResponseWriter, r *http.Request) (logFilter, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	tenant, known := api.tokens[token]
+	if !ok || !known {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return logFilter{}, false
+	}
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return logFilter{}, false
+	}
+	if tenant != allTenants {
+		if filter.Tenant != "" && filter.Tenant != tenant {
+			respondWithError(w, http.StatusForbidden, "Token does not belong to tenant")
+			return logFilter{}, false
+		}
+		filter.Tenant = tenant
+	}
+	return filter, true
+}
+
+func (api *logAPI) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs/search", api.search)
+	mux.HandleFunc("/logs/tail", api.tailLogs)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", api.checker.Healthz)
+	mux.HandleFunc("/readyz", api.checker.Readyz)
+	return mux
+}
+
+type searchResult struct {
+	Entries    []LogEntry `json:"entries"`
+	NextCursor string     `json:"nextcursor,omitempty"`
+}
+
+// search returns the entries matching the filter, newest first. A page ends
+// with nextcursor when more entries match; pass it as cursor for the next
+// page.
+func (api *logAPI) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	filter, ok := api.filter(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+	}
+
+	query := filter.query()
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		after, err := decodeCursor(raw)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		query = append(query, after)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), searchQueryTimeout)
+	defer cancel()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit) + 1)
+	cursor, err := api.collection.Find(ctx, query, opts)
+	if err != nil {
+		log.Printf("Log search failed: %s", err)
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result := searchResult{Entries: []LogEntry{}}
+	if err := cursor.All(ctx, &result.Entries); err != nil {
+		log.Printf("Log search failed: %s", err)
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(result.Entries) > limit {
+		result.Entries = result.Entries[:limit]
+		result.NextCursor = encodeCursor(result.Entries[limit-1])
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// encodeCursor returns the position after entry in the search order.
+func encodeCursor(entry LogEntry) string {
+	raw := strconv.FormatInt(entry.Time.UnixNano(), 10) + ":" + entry.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the query condition selecting the entries after a
+// cursor.
+func decodeCursor(cursor string) (bson.E, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return bson.E{}, err
+	}
+	nanos, hexID, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return bson.E{}, fmt.Errorf("malformed cursor")
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return bson.E{}, err
+	}
+	id, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return bson.E{}, err
+	}
+	t := time.Unix(0, unixNano).UTC()
+	return bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "time", Value: bson.D{{Key: "$lt", Value: t}}}},
+		bson.D{{Key: "time", Value: t}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}}},
+	}}, nil
+}
+
+// tailLogs streams the entries stored from now on that match the filter as
+// Server-Sent Events.
+func (api *logAPI) tailLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	filter, ok := api.filter(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	entries := api.tail.subscribe(filter)
+	defer api.tail.unsubscribe(entries)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(tailKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-api.tail.closed:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case entry := <-entries:
+			data, err := json.Marshal(entry)
+			if err != nil {
+				log.Printf("Failed to encode log entry: %s", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: log\ndata: %s\n\n", entry.ID.Hex(), data)
+			flusher.Flush()
+		}
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(payload)
+}
+
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	respondWithJSON(w, code, map[string]string{"error": message})
+}
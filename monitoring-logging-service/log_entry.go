@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"common/requestid"
+)
+
+const (
+	levelDebug = "debug"
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+var logLevels = map[string]bool{levelDebug: true, levelInfo: true, levelWarn: true, levelError: true}
+
+// LogEntry is a log message as stored in Mongo. Publishers send it as JSON;
+// Legacy marks plain text messages stored with a guessed level and service.
+// ExpireAt is set from the retention of the level; past it the entry is
+// archived and then deleted.
+type LogEntry struct {
+	ID            primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Time          time.Time              `json:"time" bson:"time"`
+	Service       string                 `json:"service" bson:"service"`
+	Level         string                 `json:"level" bson:"level"`
+	Message       string                 `json:"message" bson:"message"`
+	CorrelationID string                 `json:"correlationid,omitempty" bson:"correlationid,omitempty"`
+	ItemCode      string                 `json:"itemcode,omitempty" bson:"itemcode,omitempty"`
+	EventType     string                 `json:"eventtype,omitempty" bson:"eventtype,omitempty"`
+	Fields        map[string]interface{} `json:"fields,omitempty" bson:"fields,omitempty"`
+	Tenant        string                 `json:"tenant" bson:"tenant"`
+	Legacy        bool                   `json:"legacy,omitempty" bson:"legacy,omitempty"`
+	ExpireAt      time.Time              `json:"expireat" bson:"expireat"`
+	Archived      bool                   `json:"-" bson:"archived,omitempty"`
+}
+
+// parseLogEntry reads a logging_queue delivery. Messages that are not a
+// structured entry are kept as plain text, with the level taken from the
+// logging.<level> routing key.
+func parseLogEntry(d amqp091.Delivery) LogEntry {
+	tenantID, _ := d.Headers["x-tenant-id"].(string)
+
+	var entry LogEntry
+	if err := json.Unmarshal(d.Body, &entry); err != nil || entry.Message == "" {
+		entry = LogEntry{
+			Service: d.AppId,
+			Level:   strings.TrimPrefix(d.RoutingKey, "logging."),
+			Message: legacyMessage(d.Body),
+			Legacy:  true,
+		}
+	}
+
+	entry.Tenant = tenantID
+	if entry.CorrelationID == "" {
+		// Publishers that only set the header still get correlated
+		entry.CorrelationID, _ = d.Headers[requestid.Header].(string)
+	}
+	entry.Level = strings.ToLower(entry.Level)
+	if !logLevels[entry.Level] {
+		entry.Level = levelInfo
+	}
+	if entry.Service == "" {
+		entry.Service = "unknown"
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	return entry
+}
+
+// legacyMessage returns the text of a plain message. Some publishers sent
+// their text JSON encoded, so a JSON string is unquoted.
+func legacyMessage(body []byte) string {
+	var text string
+	if err := json.Unmarshal(body, &text); err == nil {
+		return text
+	}
+	return string(body)
+}
+
+// ensureLogIndexes creates the indexes log queries filter and sort on.
+func ensureLogIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "level", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "service", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "correlationid", Value: 1}}, Options: options.Index().SetSparse(true)},
+		// Entries are only deleted once the archiver has copied them.
+		{Keys: bson.D{{Key: "expireat", Value: 1}}, Options: options.Index().
+			SetExpireAfterSeconds(0).
+			SetPartialFilterExpression(bson.D{{Key: "archived", Value: true}})},
+		{Keys: bson.D{{Key: "archived", Value: 1}, {Key: "expireat", Value: 1}}},
+	})
+	return err
+}
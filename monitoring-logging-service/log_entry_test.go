@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+
+	"common/requestid"
+)
+
+func TestParseLogEntryCorrelationID(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp091.Table
+		body    string
+		want    string
+	}{
+		{"from the entry", amqp091.Table{requestid.Header: "r2"}, `{"message":"stored","correlationid":"r1"}`, "r1"},
+		{"from the header", amqp091.Table{requestid.Header: "r2"}, `{"message":"stored"}`, "r2"},
+		{"legacy message", amqp091.Table{requestid.Header: "r2"}, `stored`, "r2"},
+		{"none", nil, `{"message":"stored"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parseLogEntry(amqp091.Delivery{RoutingKey: "logging.info", Headers: tt.headers, Body: []byte(tt.body)})
+			if entry.CorrelationID != tt.want {
+				t.Errorf("correlation ID = %q, want %q", entry.CorrelationID, tt.want)
+			}
+		})
+	}
+}
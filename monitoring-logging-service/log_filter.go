@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// logFilter selects log entries by time range, level, service, correlation
+// ID, product, event type, tenant and message text. Empty fields match
+// everything.
+type logFilter struct {
+	From          time.Time
+	To            time.Time
+	Levels        []string
+	Service       string
+	CorrelationID string
+	ItemCode      string
+	EventType     string
+	Tenant        string
+	Text          string
+}
+
+// parseLogFilter reads a filter from the query string. Times are RFC 3339
+// and level takes a comma separated list.
+func parseLogFilter(r *http.Request) (logFilter, error) {
+	query := r.URL.Query()
+	filter := logFilter{
+		Service:       query.Get("service"),
+		CorrelationID: query.Get("correlationid"),
+		ItemCode:      query.Get("itemcode"),
+		EventType:     query.Get("eventtype"),
+		Tenant:        query.Get("tenant"),
+		Text:          query.Get("q"),
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if raw := query.Get(bound.name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: %v", bound.name, err)
+			}
+			*bound.value = t
+		}
+	}
+
+	if raw := query.Get("level"); raw != "" {
+		for _, level := range strings.Split(raw, ",") {
+			level = strings.ToLower(strings.TrimSpace(level))
+			if !logLevels[level] {
+				return filter, fmt.Errorf("invalid level %q", level)
+			}
+			filter.Levels = append(filter.Levels, level)
+		}
+	}
+	return filter, nil
+}
+
+// query returns the Mongo query matching the filter.
+func (f logFilter) query() bson.D {
+	query := bson.D{}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		timeRange := bson.D{}
+		if !f.From.IsZero() {
+			timeRange = append(timeRange, bson.E{Key: "$gte", Value: f.From})
+		}
+		if !f.To.IsZero() {
+			timeRange = append(timeRange, bson.E{Key: "$lt", Value: f.To})
+		}
+		query = append(query, bson.E{Key: "time", Value: timeRange})
+	}
+	if len(f.Levels) > 0 {
+		query = append(query, bson.E{Key: "level", Value: bson.D{{Key: "$in", Value: f.Levels}}})
+	}
+	for _, field := range []struct{ key, value string }{
+		{"service", f.Service},
+		{"correlationid", f.CorrelationID},
+		{"itemcode", f.ItemCode},
+		{"eventtype", f.EventType},
+		{"tenant", f.Tenant},
+	} {
+		if field.value != "" {
+			query = append(query, bson.E{Key: field.key, Value: field.value})
+		}
+	}
+	if f.Text != "" {
+		query = append(query, bson.E{Key: "message", Value: bson.D{
+			{Key: "$regex", Value: regexp.QuoteMeta(f.Text)},
+			{Key: "$options", Value: "i"},
+		}})
+	}
+	return query
+}
+
+// matches reports whether entry passes the filter, for entries that are
+// streamed rather than queried.
+func (f logFilter) matches(entry LogEntry) bool {
+	if !f.From.IsZero() && entry.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !entry.Time.Before(f.To) {
+		return false
+	}
+	if len(f.Levels) > 0 {
+		found := false
+		for _, level := range f.Levels {
+			found = found || level == entry.Level
+		}
+		if !found {
+			return false
+		}
+	}
+	if (f.Service != "" && f.Service != entry.Service) ||
+		(f.CorrelationID != "" && f.CorrelationID != entry.CorrelationID) ||
+		(f.ItemCode != "" && f.ItemCode != entry.ItemCode) ||
+		(f.EventType != "" && f.EventType != entry.EventType) ||
+		(f.Tenant != "" && f.Tenant != entry.Tenant) {
+		return false
+	}
+	return f.Text == "" || strings.Contains(strings.ToLower(entry.Message), strings.ToLower(f.Text))
+}
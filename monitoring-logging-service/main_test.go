@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTransientStoreError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timed out", fmt.Errorf("insert: %w", context.DeadlineExceeded), true},
+		{"client disconnected", mongo.ErrClientDisconnected, true},
+		{"network", mongo.CommandError{Code: 6, Labels: []string{"NetworkError"}}, true},
+		{"primary stepped down", mongo.CommandError{Code: 189, Labels: []string{"RetryableWriteError"}}, true},
+		{"duplicate key", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, false},
+		{"document too large", mongo.CommandError{Code: 10334, Message: "BSONObjectTooLarge"}, false},
+		{"failed validation", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, false},
+		{"other", errors.New("cannot transform type"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transientStoreError(tt.err); got != tt.want {
+				t.Errorf("transientStoreError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_consumed_total",
+		Help: "Messages received from RabbitMQ by queue.",
+	}, []string{"queue"})
+
+	messagesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_failed_total",
+		Help: "Messages that could not be processed by queue and reason.",
+	}, []string{"queue", "reason"})
+
+	logEntriesStored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_entries_stored_total",
+		Help: "Log entries stored by service and level.",
+	}, []string{"service", "level"})
+
+	alertsFired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alerts_fired_total",
+		Help: "Alerts fired by rule.",
+	}, []string{"rule"})
+
+	logEntriesArchived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "log_entries_archived_total",
+		Help: "Expired log entries written to archive files.",
+	})
+
+	mongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongo_operation_duration_seconds",
+		Help:    "Latency of MongoDB commands by command name and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command", "result"})
+)
+
+// mongoMonitor returns a command monitor that times every MongoDB command.
+func mongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			mongoOperationDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	notifyTimeout   = 10 * time.Second
+	alertQueueSize  = 100
+	notifierWebhook = "webhook"
+	notifierSMTP    = "smtp"
+	notifierLogfile = "logfile"
+)
+
+// notifierConfig configures one notifier of the alert rules file. Which
+// fields apply depends on Type.
+type notifierConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+
+	// webhook
+	URL string `yaml:"url"`
+
+	// smtp
+	Addr     string   `yaml:"addr"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+
+	// logfile
+	Path string `yaml:"path"`
+}
+
+func (c notifierConfig) validate() error {
+	switch c.Type {
+	case notifierWebhook:
+		if c.URL == "" {
+			return errors.New("webhook needs url")
+		}
+	case notifierSMTP:
+		if c.Addr == "" || c.From == "" || len(c.To) == 0 {
+			return errors.New("smtp needs addr, from and to")
+		}
+	case notifierLogfile:
+		if c.Path == "" {
+			return errors.New("logfile needs path")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", c.Type)
+	}
+	return nil
+}
+
+// notifier delivers fired alerts somewhere.
+type notifier interface {
+	notify(ctx context.Context, a alert) error
+}
+
+func newNotifier(c notifierConfig) notifier {
+	switch c.Type {
+	case notifierWebhook:
+		return &webhookNotifier{url: c.URL, client: &http.Client{Timeout: notifyTimeout}}
+	case notifierSMTP:
+		return &smtpNotifier{addr: c.Addr, from: c.From, to: c.To, username: c.Username, password: c.Password}
+	default:
+		return &logfileNotifier{path: c.Path}
+	}
+}
+
+// webhookNotifier posts alerts as JSON.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, a alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier mails alerts. Without a username it sends unauthenticated,
+// as local relays and the alertsink stand-in expect.
+type smtpNotifier struct {
+	addr     string
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (n *smtpNotifier) notify(ctx context.Context, a alert) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		host, _, _ := strings.Cut(n.addr, ":")
+		auth = smtp.PlainAuth("", n.username, n.password, host)
+	}
+
+	details, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: [msPOS alert] %s\r\n", a.Rule)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nLast message: %s\r\n\r\n%s\r\n", a.summary(), a.Message, details)
+	return smtp.SendMail(n.addr, auth, n.from, n.to, msg.Bytes())
+}
+
+// logfileNotifier appends alerts to a file as JSON lines.
+type logfileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (n *logfileNotifier) notify(ctx context.Context, a alert) error {
+	line, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// alertDispatcher sends fired alerts to their notifiers in the background
+// so slow notifiers do not hold up log consumption.
+type alertDispatcher struct {
+	notifiers map[string]notifier
+	alerts    chan alert
+	done      chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newAlertDispatcher(configs []notifierConfig) *alertDispatcher {
+	d := &alertDispatcher{notifiers: make(map[string]notifier), alerts: make(chan alert, alertQueueSize), done: make(chan struct{})}
+	for _, c := range configs {
+		d.notifiers[c.Name] = newNotifier(c)
+	}
+	go d.run()
+	return d
+}
+
+// dispatch queues a for delivery, dropping it when the queue is full or the
+// dispatcher is closed.
+func (d *alertDispatcher) dispatch(a alert) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		log.Printf("Alert dispatcher closed, dropping alert %s", a.Rule)
+		return
+	}
+	select {
+	case d.alerts <- a:
+	default:
+		log.Printf("Alert queue full, dropping alert %s", a.Rule)
+	}
+}
+
+// close stops taking alerts and waits until the queued ones are sent or ctx
+// is done.
+func (d *alertDispatcher) close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.alerts)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *alertDispatcher) run() {
+	defer close(d.done)
+	for a := range d.alerts {
+		log.Print(a.summary())
+		alertsFired.WithLabelValues(a.Rule).Inc()
+		for _, name := range a.notify {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			if err := d.notifiers[name].notify(ctx, a); err != nil {
+				log.Printf("Notifier %s failed for alert %s: %s", name, a.Rule, err)
+			}
+			cancel()
+		}
+	}
+}
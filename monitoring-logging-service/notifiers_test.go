@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestNotifierConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  notifierConfig
+		wantErr string
+	}{
+		{"webhook", notifierConfig{Type: notifierWebhook, URL: "http://localhost:9095/alerts"}, ""},
+		{"webhook without url", notifierConfig{Type: notifierWebhook}, "webhook needs url"},
+		{"smtp", notifierConfig{Type: notifierSMTP, Addr: "localhost:2525", From: "alerts@mspos.local", To: []string{"ops@mspos.local"}}, ""},
+		{"smtp without recipients", notifierConfig{Type: notifierSMTP, Addr: "localhost:2525", From: "alerts@mspos.local"}, "smtp needs addr, from and to"},
+		{"smtp without addr", notifierConfig{Type: notifierSMTP, From: "alerts@mspos.local", To: []string{"ops@mspos.local"}}, "smtp needs addr, from and to"},
+		{"logfile", notifierConfig{Type: notifierLogfile, Path: "alerts.log"}, ""},
+		{"logfile without path", notifierConfig{Type: notifierLogfile}, "logfile needs path"},
+		{"unknown type", notifierConfig{Type: "pager"}, `unknown type "pager"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("validate = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,42 +1,49 @@
 package handlers
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "log"
     "net/http"
+    "product-service/metrics"
     "product-service/models"
     "product-service/service"
-    "product-service/utils"    
+    "common/tracing"
+    "product-service/utils"
+    "common/requestid"
 
     "go.mongodb.org/mongo-driver/mongo"
     "github.com/rabbitmq/amqp091-go"
+    "common/rabbitmq"
+    "common/topology"
 )
 
-var ch *amqp091.Channel
+var rabbitMQ *rabbitmq.Manager
 
-func InitRabbitMQ(channel *amqp091.Channel) {
-    ch = channel
+func InitRabbitMQ(manager *rabbitmq.Manager) {
+    rabbitMQ = manager
 }
 
 func InsertProduct(w http.ResponseWriter, r *http.Request) {
     var product models.Product
     if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-        publishToQueue("logging_queue", err.Error())
+        publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
         utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
         return
     }
     defer r.Body.Close()
 
     // Insert Master Product to MongoDB
-    if err := service.InsertProduct(product); err != nil {
-        publishToQueue("product_dlq", product)
+    if err := service.InsertProduct(r.Context(), product); err != nil {
+        publishToQueue(r.Context(), topology.ProductDLQ, product)
         utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
         return
     }
 
     // Call service function to update the product via RabbitMQ
-    if err := service.PublishInsertProduct(product); err != nil {       
+    if err := service.PublishInsertProduct(r.Context(), product); err != nil {       
         utils.RespondWithError(w, http.StatusInternalServerError, "Failed to publish insert product message")
         return
     }
@@ -50,7 +57,7 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
     // Decode JSON payload from request body into models.Product struct
     if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-        publishToQueue("logging_queue", err.Error())
+        publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
         log.Printf("Error decoding JSON: %v", err)
         utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
         return
@@ -58,14 +65,14 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
     defer r.Body.Close()
 
     // Update Master Product to MongoDB
-    if err := service.UpdateProduct(product); err != nil {
-        publishToQueue("product_dlq", product)
+    if err := service.UpdateProduct(r.Context(), product); err != nil {
+        publishToQueue(r.Context(), topology.ProductDLQ, product)
         utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
         return
     }
 
     // Call service function to update the product via RabbitMQ
-    if err := service.PublishUpdateProduct(product); err != nil {        
+    if err := service.PublishUpdateProduct(r.Context(), product); err != nil {        
         utils.RespondWithError(w, http.StatusInternalServerError, "Failed to publish update product message")
         return
     }
@@ -76,12 +83,14 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
 func SelectProduct(w http.ResponseWriter, r *http.Request) {
     name := r.URL.Query().Get("name")
-    product, err := service.SelectProduct(name)
+    product, err := service.SelectProduct(r.Context(), name)
     if err != nil {
         if err == mongo.ErrNoDocuments {
             utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+        } else if errors.Is(err, service.ErrProductUnavailable) {
+            utils.RespondWithError(w, http.StatusNotFound, "Product not available in this store")
         } else {
-            publishToQueue("logging_queue", err.Error())
+            publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
             utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
         }
         return
@@ -92,31 +101,67 @@ func SelectProduct(w http.ResponseWriter, r *http.Request) {
 func DeleteProduct(w http.ResponseWriter, r *http.Request) {
     name := r.URL.Query().Get("name")
     fmt.Println("name ", name)
-    if err := service.DeleteProduct(name); err != nil {
-        publishToQueue("logging_queue", err.Error())
-        utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+    product, err := service.DeleteProduct(r.Context(), name)
+    if err != nil {
+        if err == mongo.ErrNoDocuments {
+            utils.RespondWithError(w, http.StatusNotFound, "Product not found")
+        } else {
+            publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+            utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+        }
+        return
+    }
+
+    // Let subscribers of the catalog feed know the product is gone
+    if err := service.PublishDeleteProduct(r.Context(), product); err != nil {
+        utils.RespondWithError(w, http.StatusInternalServerError, "Failed to publish delete product message")
         return
     }
     utils.RespondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
 }
 
-func publishToQueue(queueName string, message interface{}) {
+// queueRoutingKeys maps the queues bound to error_exchange to the routing
+// key that reaches them.
+var queueRoutingKeys = map[string]string{
+    topology.ProductDLQ:   topology.KeyDeadLetter,
+    topology.LoggingQueue: topology.LoggingKey(models.LogLevelError),
+}
+
+func publishToQueue(ctx context.Context, queueName string, message interface{}) {
+    // Errors for the logging queue are sent as structured log entries
+    if text, ok := message.(string); ok && queueName == topology.LoggingQueue {
+        entry := service.NewLogEntry(models.LogLevelError, text)
+        entry.CorrelationID = requestid.FromContext(ctx)
+        message = entry
+    }
+
+    routingKey, ok := queueRoutingKeys[queueName]
+    if !ok {
+        log.Printf("Failed to publish message: no routing key for queue %s", queueName)
+        return
+    }
+
     body, err := json.Marshal(message)
     if err != nil {
         log.Printf("Failed to marshal message: %s", err)
         return
     }
 
-    err = ch.Publish(
-        "error_exchange",        // exchange
-        queueName, // routing key (queue name)
-        false,     // mandatory
-        false,     // immediate
+    ctx, span := tracing.StartPublish(ctx, topology.ErrorExchange, routingKey)
+    defer span.End()
+
+    err = rabbitMQ.Publish(ctx,
+        topology.ErrorExchange, // exchange
+        routingKey,             // routing key
+        true,                   // mandatory
         amqp091.Publishing{
             ContentType: "application/json",
+            Headers:     service.MessageHeaders(ctx),
             Body:        body,
         })
+    metrics.ObservePublish(topology.ErrorExchange, routingKey, err)
     if err != nil {
+        span.RecordError(err)
         log.Printf("Failed to publish message to queue %s: %s", queueName, err)
     }
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-service/models"
+	"product-service/service"
+	"product-service/utils"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	var purchaseOrder models.PurchaseOrder
+	if err := json.NewDecoder(r.Body).Decode(&purchaseOrder); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	purchaseOrder, err := service.CreatePurchaseOrder(r.Context(), purchaseOrder)
+	if err != nil {
+		respondWithPurchaseOrderError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, purchaseOrder)
+}
+
+func SelectPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	purchaseOrder, err := service.SelectPurchaseOrder(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithPurchaseOrderError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, purchaseOrder)
+}
+
+func SendPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	purchaseOrder, err := service.SendPurchaseOrder(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithPurchaseOrderError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, purchaseOrder)
+}
+
+func ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	var goodsReceipt models.GoodsReceipt
+	if err := json.NewDecoder(r.Body).Decode(&goodsReceipt); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	purchaseOrder, err := service.ReceivePurchaseOrder(r.Context(), goodsReceipt)
+	if err != nil {
+		respondWithPurchaseOrderError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, purchaseOrder)
+}
+
+func ClosePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	purchaseOrder, err := service.ClosePurchaseOrder(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithPurchaseOrderError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, purchaseOrder)
+}
+
+func respondWithPurchaseOrderError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		utils.RespondWithError(w, http.StatusNotFound, "Purchase order not found")
+	case errors.Is(err, service.ErrInvalidPurchaseOrder):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrConcurrentUpdate):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-service/models"
+	"product-service/service"
+	"product-service/utils"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreateRefund(w http.ResponseWriter, r *http.Request) {
+	var refund models.Refund
+	if err := json.NewDecoder(r.Body).Decode(&refund); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	refund, err := service.CreateRefund(r.Context(), refund)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefund) {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrConcurrentRefund) {
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusCreated
+	if refund.Status == models.RefundStatusPendingApproval {
+		status = http.StatusAccepted
+	}
+	utils.RespondWithJSON(w, status, refund)
+}
+
+func ApproveRefund(w http.ResponseWriter, r *http.Request) {
+	var approval models.RefundApproval
+	if err := json.NewDecoder(r.Body).Decode(&approval); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	refund, err := service.ApproveRefund(r.Context(), r.Header.Get("X-Manager-Token"), approval)
+	if err != nil {
+		switch {
+		case err == mongo.ErrNoDocuments:
+			utils.RespondWithError(w, http.StatusNotFound, "Refund not found")
+		case errors.Is(err, service.ErrRefundNotPending):
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, service.ErrApproverNotAuthenticated):
+			utils.RespondWithError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, service.ErrApproverNotEligible):
+			utils.RespondWithError(w, http.StatusForbidden, err.Error())
+		default:
+			publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, refund)
+}
+
+func SelectRefund(w http.ResponseWriter, r *http.Request) {
+	refundID := r.URL.Query().Get("id")
+	refund, err := service.SelectRefund(r.Context(), refundID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			utils.RespondWithError(w, http.StatusNotFound, "Refund not found")
+		} else {
+			publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, refund)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-service/models"
+	"product-service/service"
+	"product-service/utils"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func OpenShift(w http.ResponseWriter, r *http.Request) {
+	var shift models.Shift
+	if err := json.NewDecoder(r.Body).Decode(&shift); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	shift, err := service.OpenShift(r.Context(), shift)
+	if err != nil {
+		respondWithShiftError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, shift)
+}
+
+func SelectShift(w http.ResponseWriter, r *http.Request) {
+	shift, err := service.SelectShift(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithShiftError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, shift)
+}
+
+func RecordCashMovement(w http.ResponseWriter, r *http.Request) {
+	var movement models.ShiftCashMovement
+	if err := json.NewDecoder(r.Body).Decode(&movement); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	shift, err := service.RecordCashMovement(r.Context(), movement)
+	if err != nil {
+		respondWithShiftError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, shift)
+}
+
+func RecordTaking(w http.ResponseWriter, r *http.Request) {
+	var taking models.ShiftTaking
+	if err := json.NewDecoder(r.Body).Decode(&taking); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	shift, err := service.RecordTaking(r.Context(), taking)
+	if err != nil {
+		respondWithShiftError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, shift)
+}
+
+func CloseShift(w http.ResponseWriter, r *http.Request) {
+	var shiftClose models.ShiftClose
+	if err := json.NewDecoder(r.Body).Decode(&shiftClose); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	shift, err := service.CloseShift(r.Context(), shiftClose)
+	if err != nil {
+		respondWithShiftError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, shift)
+}
+
+// ShiftReport returns the X or Z report of a shift, as JSON by default or as
+// printable text with format=text.
+func ShiftReport(w http.ResponseWriter, r *http.Request) {
+	report, err := service.ShiftReport(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithShiftError(w, r, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "text" {
+		utils.RespondWithText(w, http.StatusOK, service.FormatShiftReport(report))
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, report)
+}
+
+func respondWithShiftError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		utils.RespondWithError(w, http.StatusNotFound, "Shift not found")
+	case errors.Is(err, service.ErrInvalidShift):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrShiftAlreadyOpen), errors.Is(err, service.ErrShiftNotOpen), errors.Is(err, service.ErrShiftChanged):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
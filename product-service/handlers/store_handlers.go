@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-service/models"
+	"product-service/service"
+	"product-service/utils"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func InsertStore(w http.ResponseWriter, r *http.Request) {
+	var store models.Store
+	if err := json.NewDecoder(r.Body).Decode(&store); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	store.Active = true
+	if err := service.InsertStore(r.Context(), store); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, store)
+}
+
+func UpdateStore(w http.ResponseWriter, r *http.Request) {
+	var store models.Store
+	if err := json.NewDecoder(r.Body).Decode(&store); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := service.UpdateStore(r.Context(), store); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, store)
+}
+
+func SelectStore(w http.ResponseWriter, r *http.Request) {
+	store, err := service.SelectStore(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, store)
+}
+
+func UpdateStoreProduct(w http.ResponseWriter, r *http.Request) {
+	var storeProduct models.StoreProduct
+	if err := json.NewDecoder(r.Body).Decode(&storeProduct); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := service.UpdateStoreProduct(r.Context(), storeProduct); err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, storeProduct)
+}
+
+func SelectStoreProduct(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	storeProduct, err := service.SelectStoreProduct(r.Context(), query.Get("storeid"), query.Get("itemcode"))
+	if err != nil {
+		respondWithStoreError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, storeProduct)
+}
+
+func respondWithStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		utils.RespondWithError(w, http.StatusNotFound, "Store not found")
+	case errors.Is(err, service.ErrInvalidStore):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-service/models"
+	"product-service/service"
+	"product-service/utils"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func InsertSupplier(w http.ResponseWriter, r *http.Request) {
+	var supplier models.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	supplier.Active = true
+	if err := service.InsertSupplier(r.Context(), supplier); err != nil {
+		respondWithSupplierError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, supplier)
+}
+
+func UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	var supplier models.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := service.UpdateSupplier(r.Context(), supplier); err != nil {
+		respondWithSupplierError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, supplier)
+}
+
+func SelectSupplier(w http.ResponseWriter, r *http.Request) {
+	supplier, err := service.SelectSupplier(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		respondWithSupplierError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, supplier)
+}
+
+func UpdateSupplierProduct(w http.ResponseWriter, r *http.Request) {
+	var supplierProduct models.SupplierProduct
+	if err := json.NewDecoder(r.Body).Decode(&supplierProduct); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := service.UpdateSupplierProduct(r.Context(), supplierProduct); err != nil {
+		respondWithSupplierError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, supplierProduct)
+}
+
+func SelectSupplierProducts(w http.ResponseWriter, r *http.Request) {
+	supplierProducts, err := service.SelectSupplierProducts(r.Context(), r.URL.Query().Get("supplierid"))
+	if err != nil {
+		respondWithSupplierError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, supplierProducts)
+}
+
+func respondWithSupplierError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		utils.RespondWithError(w, http.StatusNotFound, "Supplier not found")
+	case errors.Is(err, service.ErrInvalidSupplier):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"common/topology"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"product-service/models"
+	"product-service/service"
+	"product-service/utils"
+	"strconv"
+)
+
+func SyncSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := service.SyncSnapshot(r.Context())
+	if err != nil {
+		respondWithSyncError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, snapshot)
+}
+
+func SyncChanges(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	changes, err := service.SyncChanges(r.Context(), r.URL.Query().Get("checkpoint"), limit)
+	if err != nil {
+		respondWithSyncError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, changes)
+}
+
+func SyncPush(w http.ResponseWriter, r *http.Request) {
+	var push models.SyncPush
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := service.PushSyncOps(r.Context(), push)
+	if err != nil {
+		respondWithSyncError(w, r, err)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, result)
+}
+
+func respondWithSyncError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSync), errors.Is(err, service.ErrInvalidCheckpoint):
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrSyncOpInProgress):
+		utils.RespondWithError(w, http.StatusConflict, err.Error())
+	default:
+		publishToQueue(r.Context(), topology.LoggingQueue, err.Error())
+		utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
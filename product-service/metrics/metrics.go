@@ -0,0 +1,58 @@
+// Package metrics holds the Prometheus collectors of product-service.
+package metrics
+
+import (
+	"common/rabbitmq"
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	// HTTPRequestDuration is the latency of HTTP requests by route template.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// MessagesPublished counts messages published to RabbitMQ.
+	MessagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_messages_published_total",
+		Help: "Messages published to RabbitMQ by exchange, routing key and result.",
+	}, []string{"exchange", "routing_key", "result"})
+
+	// MongoOperationDuration is the latency of MongoDB commands.
+	MongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongo_operation_duration_seconds",
+		Help:    "Latency of MongoDB commands by command name and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command", "result"})
+)
+
+// ObservePublish records the result of a RabbitMQ publish.
+func ObservePublish(exchange, routingKey string, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, rabbitmq.ErrUnroutable):
+		result = "unroutable"
+	case err != nil:
+		result = "error"
+	}
+	MessagesPublished.WithLabelValues(exchange, routingKey, result).Inc()
+}
+
+// MongoMonitor returns a command monitor that times every MongoDB command.
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			MongoOperationDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			MongoOperationDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
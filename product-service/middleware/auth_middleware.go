@@ -4,13 +4,41 @@ package middleware
 import (
     "log"
     "net/http"
+    "strconv"
     "time"
+
+    "github.com/gorilla/mux"
+    "product-service/metrics"
+    "common/requestid"
 )
 
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+    rec.status = status
+    rec.ResponseWriter.WriteHeader(status)
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         start := time.Now()
-        next.ServeHTTP(w, r)
-        log.Printf("Request %s %s took %v", r.Method, r.RequestURI, time.Since(start))
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        next.ServeHTTP(rec, r)
+        elapsed := time.Since(start)
+        log.Printf("Request %s %s [request_id=%s] took %v", r.Method, r.RequestURI, requestid.FromContext(r.Context()), elapsed)
+
+        // Label by route template so query strings do not blow up the
+        // number of series
+        route := "unknown"
+        if current := mux.CurrentRoute(r); current != nil {
+            if template, err := current.GetPathTemplate(); err == nil {
+                route = template
+            }
+        }
+        metrics.HTTPRequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Observe(elapsed.Seconds())
     })
 }
@@ -0,0 +1,39 @@
+// request_id_middleware.go
+package middleware
+
+import (
+	"common/requestid"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware takes the correlation ID of a request from its
+// X-Request-ID header, or generates one, echoes it in the response and puts
+// it in the request context.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(requestid.With(r.Context(), requestID)))
+	})
+}
+
+// validRequestID reports whether a caller supplied ID is safe to log and
+// forward: non-empty, bounded and printable ASCII without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
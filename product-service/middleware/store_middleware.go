@@ -0,0 +1,38 @@
+// store_middleware.go
+package middleware
+
+import (
+	"net/http"
+	"product-service/service"
+	"product-service/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StoreMiddleware resolves the store a request is made for from the
+// X-Store-ID header and rejects requests for unknown or inactive stores.
+func StoreMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storeID := r.Header.Get("X-Store-ID")
+		if storeID == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Missing X-Store-ID header")
+			return
+		}
+
+		store, err := service.SelectStore(r.Context(), storeID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				utils.RespondWithError(w, http.StatusBadRequest, "Unknown store")
+			} else {
+				utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		if !store.Active {
+			utils.RespondWithError(w, http.StatusForbidden, "Store is not active")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(utils.WithStoreID(r.Context(), storeID)))
+	})
+}
@@ -0,0 +1,46 @@
+// tenant_middleware.go
+package middleware
+
+import (
+	"net/http"
+	"product-service/config"
+	"product-service/utils"
+	"regexp"
+	"strings"
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,32}$`)
+
+// TenantMiddleware resolves the tenant a request belongs to from its bearer
+// token, and refuses an X-Tenant-ID header naming another tenant. Only a
+// development setup with TRUST_TENANT_HEADER takes the header on its own;
+// requests without it then use the default tenant.
+func TenantMiddleware(next http.Handler) http.Handler {
+	tokens := config.GetTenantTokens()
+	trustHeader := config.GetTrustTenantHeader()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.Header.Get("X-Tenant-ID")
+
+		if !trustHeader {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			tokenTenantID, known := tokens[token]
+			if !ok || !known {
+				utils.RespondWithError(w, http.StatusUnauthorized, "Invalid tenant token")
+				return
+			}
+			if tenantID != "" && tenantID != tokenTenantID {
+				utils.RespondWithError(w, http.StatusForbidden, "Token does not belong to tenant")
+				return
+			}
+			tenantID = tokenTenantID
+		}
+
+		if tenantID != "" && !tenantIDPattern.MatchString(tenantID) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid tenant ID")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(utils.WithTenantID(r.Context(), tenantID)))
+	})
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxMessage is an event of a change that is already stored, kept until
+// the broker confirms it. NextAttemptAt is when the relay may publish it
+// again.
+type OutboxMessage struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Exchange      string             `bson:"exchange"`
+	RoutingKey    string             `bson:"routingkey"`
+	Mandatory     bool               `bson:"mandatory"`
+	Headers       map[string]string  `bson:"headers"`
+	Body          []byte             `bson:"body"`
+	CreatedAt     time.Time          `bson:"createdat"`
+	Attempts      int                `bson:"attempts"`
+	NextAttemptAt time.Time          `bson:"nextattemptat"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+const (
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusSent              = "sent"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusClosed            = "closed"
+)
+
+type PurchaseOrderLine struct {
+	ItemCode         string  `json:"itemcode" bson:"itemcode"`
+	Quantity         int     `json:"quantity" bson:"quantity"`
+	ReceivedQuantity int     `json:"receivedquantity" bson:"receivedquantity"`
+	CostPrice        float64 `json:"costprice" bson:"costprice"`
+}
+
+type PurchaseOrder struct {
+	POID       string              `json:"poid" bson:"poid"`
+	StoreID    string              `json:"storeid" bson:"storeid"`
+	SupplierID string              `json:"supplierid" bson:"supplierid"`
+	Status     string              `json:"status" bson:"status"`
+	Lines      []PurchaseOrderLine `json:"lines" bson:"lines"`
+	Total      float64             `json:"total" bson:"total"`
+	CreatedBy  string              `json:"createdby" bson:"createdby"`
+	CreatedAt  time.Time           `json:"createdat" bson:"createdat"`
+	SentAt     *time.Time          `json:"sentat,omitempty" bson:"sentat,omitempty"`
+	ExpectedAt *time.Time          `json:"expectedat,omitempty" bson:"expectedat,omitempty"`
+	ClosedAt   *time.Time          `json:"closedat,omitempty" bson:"closedat,omitempty"`
+	Version    int                 `json:"version" bson:"version"`
+}
+
+type GoodsReceiptLine struct {
+	ItemCode string `json:"itemcode" bson:"itemcode"`
+	Quantity int    `json:"quantity" bson:"quantity"`
+}
+
+// GoodsReceipt records the quantities delivered against a purchase order.
+type GoodsReceipt struct {
+	ReceiptID  string             `json:"receiptid" bson:"receiptid"`
+	POID       string             `json:"poid" bson:"poid"`
+	StoreID    string             `json:"storeid" bson:"storeid"`
+	Lines      []GoodsReceiptLine `json:"lines" bson:"lines"`
+	ReceivedBy string             `json:"receivedby" bson:"receivedby"`
+	ReceivedAt time.Time          `json:"receivedat" bson:"receivedat"`
+}
+
+// PurchaseOrderEvent is published on every purchase order state change.
+type PurchaseOrderEvent struct {
+	PurchaseOrder  PurchaseOrder `json:"purchaseorder"`
+	PreviousStatus string        `json:"previousstatus,omitempty"`
+	GoodsReceipt   *GoodsReceipt `json:"goodsreceipt,omitempty"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+const (
+	RefundStatusPendingApproval = "pending_approval"
+	RefundStatusCompleted       = "completed"
+	RefundStatusRejected        = "rejected"
+)
+
+// Reason codes a cashier can record against a returned line.
+var RefundReasonCodes = map[string]string{
+	"DAMAGED":       "Item damaged or defective",
+	"WRONG_ITEM":    "Wrong item sold",
+	"EXPIRED":       "Item past its expiry date",
+	"CHANGED_MIND":  "Customer changed their mind",
+	"PRICE_DISPUTE": "Price charged differs from shelf price",
+	"OTHER":         "Other reason",
+}
+
+type RefundLine struct {
+	ItemCode     string  `json:"itemcode" bson:"itemcode"`
+	Quantity     int     `json:"quantity" bson:"quantity"`
+	SoldQuantity int     `json:"soldquantity" bson:"soldquantity,omitempty"`
+	ReasonCode   string  `json:"reasoncode" bson:"reasoncode"`
+	UnitPrice    float64 `json:"unitprice" bson:"unitprice"`
+	Amount       float64 `json:"amount" bson:"amount"`
+}
+
+type Refund struct {
+	RefundID    string       `json:"refundid" bson:"refundid"`
+	StoreID     string       `json:"storeid" bson:"storeid"`
+	ReceiptNo   string       `json:"receiptno" bson:"receiptno"`
+	Lines       []RefundLine `json:"lines" bson:"lines"`
+	Total       float64      `json:"total" bson:"total"`
+	Status      string       `json:"status" bson:"status"`
+	RequestedBy string       `json:"requestedby" bson:"requestedby"`
+	ApprovedBy  string       `json:"approvedby,omitempty" bson:"approvedby,omitempty"`
+	CreatedAt   time.Time    `json:"createdat" bson:"createdat"`
+	CompletedAt *time.Time   `json:"completedat,omitempty" bson:"completedat,omitempty"`
+}
+
+// RefundReceipt records the quantities sold and returned per item on a
+// receipt, so the refunds of one receipt cannot together return more than was
+// sold. Version counts its updates.
+type RefundReceipt struct {
+	StoreID   string              `json:"storeid" bson:"storeid"`
+	ReceiptNo string              `json:"receiptno" bson:"receiptno"`
+	Lines     []RefundReceiptLine `json:"lines" bson:"lines"`
+	Version   int                 `json:"version" bson:"version"`
+}
+
+type RefundReceiptLine struct {
+	ItemCode         string `json:"itemcode" bson:"itemcode"`
+	SoldQuantity     int    `json:"soldquantity" bson:"soldquantity"`
+	ReturnedQuantity int    `json:"returnedquantity" bson:"returnedquantity"`
+}
+
+type RefundApproval struct {
+	RefundID  string `json:"refundid"`
+	ManagerID string `json:"managerid"`
+	Approved  bool   `json:"approved"`
+}
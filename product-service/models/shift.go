@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+const (
+	ShiftStatusOpen   = "open"
+	ShiftStatusClosed = "closed"
+
+	CashMovementIn  = "in"
+	CashMovementOut = "out"
+
+	// PaymentMethodCash takings end up in the cash drawer, all other payment
+	// methods are only reported.
+	PaymentMethodCash = "cash"
+)
+
+type CashMovement struct {
+	Type       string    `json:"type" bson:"type"`
+	Amount     float64   `json:"amount" bson:"amount"`
+	Reason     string    `json:"reason" bson:"reason"`
+	RecordedBy string    `json:"recordedby" bson:"recordedby"`
+	RecordedAt time.Time `json:"recordedat" bson:"recordedat"`
+}
+
+type Taking struct {
+	PaymentMethod string    `json:"paymentmethod" bson:"paymentmethod"`
+	Amount        float64   `json:"amount" bson:"amount"`
+	ReceiptNo     string    `json:"receiptno" bson:"receiptno"`
+	RecordedAt    time.Time `json:"recordedat" bson:"recordedat"`
+}
+
+type Shift struct {
+	ShiftID       string         `json:"shiftid" bson:"shiftid"`
+	StoreID       string         `json:"storeid" bson:"storeid"`
+	TerminalID    string         `json:"terminalid" bson:"terminalid"`
+	CashierID     string         `json:"cashierid" bson:"cashierid"`
+	Status        string         `json:"status" bson:"status"`
+	OpeningFloat  float64        `json:"openingfloat" bson:"openingfloat"`
+	CashMovements []CashMovement `json:"cashmovements" bson:"cashmovements"`
+	Takings       []Taking       `json:"takings" bson:"takings"`
+	ExpectedCash  float64        `json:"expectedcash" bson:"expectedcash"`
+	CountedCash   *float64       `json:"countedcash,omitempty" bson:"countedcash,omitempty"`
+	OverShort     *float64       `json:"overshort,omitempty" bson:"overshort,omitempty"`
+	OpenedAt      time.Time      `json:"openedat" bson:"openedat"`
+	ClosedAt      *time.Time     `json:"closedat,omitempty" bson:"closedat,omitempty"`
+}
+
+// ShiftCashMovement is posted to record cash put into or taken out of the
+// drawer during a shift.
+type ShiftCashMovement struct {
+	ShiftID string `json:"shiftid"`
+	CashMovement
+}
+
+// ShiftTaking is posted by the till for every payment taken during a shift.
+type ShiftTaking struct {
+	ShiftID string `json:"shiftid"`
+	Taking
+}
+
+type ShiftClose struct {
+	ShiftID     string  `json:"shiftid"`
+	CountedCash float64 `json:"countedcash"`
+}
+
+// ShiftReport is the X report of an open shift or the Z report of a closed one.
+type ShiftReport struct {
+	ReportType       string             `json:"reporttype"`
+	ShiftID          string             `json:"shiftid"`
+	StoreID          string             `json:"storeid"`
+	TerminalID       string             `json:"terminalid"`
+	CashierID        string             `json:"cashierid"`
+	OpenedAt         time.Time          `json:"openedat"`
+	ClosedAt         *time.Time         `json:"closedat,omitempty"`
+	GeneratedAt      time.Time          `json:"generatedat"`
+	OpeningFloat     float64            `json:"openingfloat"`
+	CashIn           float64            `json:"cashin"`
+	CashOut          float64            `json:"cashout"`
+	TakingsByMethod  map[string]float64 `json:"takingsbymethod"`
+	TotalTakings     float64            `json:"totaltakings"`
+	TransactionCount int                `json:"transactioncount"`
+	ExpectedCash     float64            `json:"expectedcash"`
+	CountedCash      *float64           `json:"countedcash,omitempty"`
+	OverShort        *float64           `json:"overshort,omitempty"`
+}
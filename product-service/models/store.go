@@ -0,0 +1,17 @@
+package models
+
+type Store struct {
+	StoreID string `json:"storeid" bson:"storeid"`
+	Name    string `json:"name" bson:"name"`
+	Address string `json:"address" bson:"address"`
+	Active  bool   `json:"active" bson:"active"`
+}
+
+// StoreProduct overrides the catalog price and availability of a product in
+// one store. A nil Price keeps the catalog price.
+type StoreProduct struct {
+	StoreID   string   `json:"storeid" bson:"storeid"`
+	ItemCode  string   `json:"itemcode" bson:"itemcode"`
+	Price     *float64 `json:"price,omitempty" bson:"price,omitempty"`
+	Available bool     `json:"available" bson:"available"`
+}
@@ -0,0 +1,18 @@
+package models
+
+type Supplier struct {
+	SupplierID string `json:"supplierid" bson:"supplierid"`
+	Name       string `json:"name" bson:"name"`
+	Contact    string `json:"contact" bson:"contact"`
+	Email      string `json:"email" bson:"email"`
+	Phone      string `json:"phone" bson:"phone"`
+	Active     bool   `json:"active" bson:"active"`
+}
+
+// SupplierProduct links a catalog product to a supplier that can deliver it.
+type SupplierProduct struct {
+	SupplierID   string  `json:"supplierid" bson:"supplierid"`
+	ItemCode     string  `json:"itemcode" bson:"itemcode"`
+	CostPrice    float64 `json:"costprice" bson:"costprice"`
+	LeadTimeDays int     `json:"leadtimedays" bson:"leadtimedays"`
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Operations a terminal can queue while offline and push when it is back.
+const (
+	SyncOpProductUpsert      = "product.upsert"
+	SyncOpProductDelete      = "product.delete"
+	SyncOpStoreProductUpdate = "store.product.update"
+	SyncOpShiftTaking        = "shift.taking"
+	SyncOpShiftCash          = "shift.cash"
+	SyncOpRefundCreate       = "refund.create"
+)
+
+const (
+	SyncOpStatusApplied  = "applied"
+	SyncOpStatusConflict = "conflict"
+	SyncOpStatusRejected = "rejected"
+	// SyncOpStatusPending marks an operation claimed by a push that is
+	// still applying it. It is never sent to terminals.
+	SyncOpStatusPending = "pending"
+)
+
+// CatalogChange records that a product changed in one store or, with an
+// empty StoreID, in every store. Seq orders the changes of a tenant.
+type CatalogChange struct {
+	Seq        int64     `json:"seq" bson:"seq"`
+	StoreID    string    `json:"storeid" bson:"storeid"`
+	ItemCode   string    `json:"itemcode" bson:"itemcode"`
+	TerminalID string    `json:"terminalid,omitempty" bson:"terminalid,omitempty"`
+	ChangedAt  time.Time `json:"changedat" bson:"changedat"`
+}
+
+// SyncItem is a catalog product as it is sold in one store. Deleted items
+// are only sent in changes, so terminals can drop them.
+type SyncItem struct {
+	ItemCode  string  `json:"itemcode"`
+	Name      string  `json:"name,omitempty"`
+	Price     float64 `json:"price,omitempty"`
+	Category  string  `json:"category,omitempty"`
+	Jenis     string  `json:"jenis,omitempty"`
+	Available bool    `json:"available"`
+	Deleted   bool    `json:"deleted,omitempty"`
+}
+
+// SyncSnapshot is the full catalog of a store. Checkpoint is passed back to
+// fetch the changes made after the snapshot was taken.
+type SyncSnapshot struct {
+	Checkpoint string     `json:"checkpoint"`
+	Items      []SyncItem `json:"items"`
+}
+
+// SyncChanges holds the current state of the items changed since a
+// checkpoint. HasMore asks the terminal to fetch again from Checkpoint.
+// Resync means the checkpoint is unknown and a new snapshot is needed.
+type SyncChanges struct {
+	Checkpoint string     `json:"checkpoint"`
+	Items      []SyncItem `json:"items"`
+	HasMore    bool       `json:"hasmore"`
+	Resync     bool       `json:"resync,omitempty"`
+}
+
+// SyncOp is an operation recorded by a terminal while offline. OpID is
+// generated by the terminal and makes pushing the operation again harmless.
+// BaseCheckpoint is the checkpoint the terminal had synced to when the
+// operation was recorded.
+type SyncOp struct {
+	OpID           string          `json:"opid"`
+	Type           string          `json:"type"`
+	CreatedAt      time.Time       `json:"createdat"`
+	BaseCheckpoint string          `json:"basecheckpoint"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+type SyncPush struct {
+	TerminalID string   `json:"terminalid"`
+	Ops        []SyncOp `json:"ops"`
+}
+
+// SyncOpResult is the outcome of one pushed operation. Item carries the
+// server's version of the product when the operation lost a conflict.
+type SyncOpResult struct {
+	OpID      string          `json:"opid" bson:"opid"`
+	Type      string          `json:"type" bson:"type"`
+	Status    string          `json:"status" bson:"status"`
+	Error     string          `json:"error,omitempty" bson:"error,omitempty"`
+	Item      *SyncItem       `json:"item,omitempty" bson:"item,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty" bson:"result,omitempty"`
+	Duplicate bool            `json:"duplicate,omitempty" bson:"-"`
+}
+
+type SyncPushResult struct {
+	Checkpoint string         `json:"checkpoint"`
+	Results    []SyncOpResult `json:"results"`
+}
+
+// SyncOpRecord remembers the outcome of an operation so a terminal pushing
+// it again gets the same answer.
+type SyncOpRecord struct {
+	StoreID    string       `bson:"storeid"`
+	TerminalID string       `bson:"terminalid"`
+	Result     SyncOpResult `bson:"result"`
+	RecordedAt time.Time    `bson:"recordedat"`
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"product-service/models"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxIndexedDatabases remembers the databases whose outbox index exists.
+var outboxIndexedDatabases sync.Map
+
+// outboxCollection returns the outbox of the tenant carried by ctx,
+// creating its index the first time it is used.
+func outboxCollection(ctx context.Context) (*mongo.Collection, error) {
+	db := database(ctx)
+	collection := db.Collection("outbox_collection")
+	if _, ok := outboxIndexedDatabases.Load(db.Name()); ok {
+		return collection, nil
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "nextattemptat", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("create outbox index in %s: %w", db.Name(), err)
+	}
+	outboxIndexedDatabases.Store(db.Name(), true)
+	return collection, nil
+}
+
+func InsertOutboxMessage(ctx context.Context, message models.OutboxMessage) error {
+	collection, err := outboxCollection(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = collection.InsertOne(ctx, message)
+	return err
+}
+
+func DeleteOutboxMessage(ctx context.Context, id primitive.ObjectID) error {
+	collection := database(ctx).Collection("outbox_collection")
+	_, err := collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	return err
+}
+
+// ClaimOutboxMessage returns the message due longest and holds it back from
+// other relays for lease. It returns mongo.ErrNoDocuments when none is due.
+func ClaimOutboxMessage(ctx context.Context, lease time.Duration) (models.OutboxMessage, error) {
+	var message models.OutboxMessage
+	collection, err := outboxCollection(ctx)
+	if err != nil {
+		return message, err
+	}
+	now := time.Now().UTC()
+	filter := bson.D{{Key: "nextattemptat", Value: bson.D{{Key: "$lte", Value: now}}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "nextattemptat", Value: now.Add(lease)}}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextattemptat", Value: 1}}).SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	return message, err
+}
+
+// SelectTenantIDs returns the tenants that have a database, "" standing for
+// the default tenant.
+func SelectTenantIDs(ctx context.Context) ([]string, error) {
+	filter := bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: "^product(_|$)"}}}}
+	names, err := client.ListDatabaseNames(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	tenantIDs := make([]string, 0, len(names))
+	for _, name := range names {
+		tenantIDs = append(tenantIDs, strings.TrimPrefix(strings.TrimPrefix(name, "product"), "_"))
+	}
+	return tenantIDs, nil
+}
@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"fmt"
+	"product-service/metrics"
 	"product-service/models"
+	"product-service/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,9 +15,9 @@ import (
 var client *mongo.Client
 
 // InitMongoClient initializes the MongoDB client
-func InitMongoClient() error {
+func InitMongoClient(uri string) error {
     // Set client options
-    clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
+    clientOptions := options.Client().ApplyURI(uri).SetMonitor(metrics.MongoMonitor())
 
     // Connect to MongoDB
     var err error
@@ -32,31 +34,63 @@ func InitMongoClient() error {
     return nil
 }
 
+// CloseMongoClient disconnects the MongoDB client.
+func CloseMongoClient(ctx context.Context) error {
+    return client.Disconnect(ctx)
+}
+
+// PingMongo checks that MongoDB can be reached.
+func PingMongo(ctx context.Context) error {
+    return client.Ping(ctx, nil)
+}
 
-func InsertProduct(product models.Product) error {
-    collection := client.Database("product").Collection("product_collection")
-    _, err := collection.InsertOne(context.TODO(), product)
+// database returns the database of the tenant carried by ctx. Requests
+// without a tenant use the original "product" database.
+func database(ctx context.Context) *mongo.Database {
+    if tenantID := utils.TenantIDFromContext(ctx); tenantID != "" {
+        return client.Database("product_" + tenantID)
+    }
+    return client.Database("product")
+}
+
+func InsertProduct(ctx context.Context, product models.Product) error {
+    collection := database(ctx).Collection("product_collection")
+    _, err := collection.InsertOne(ctx, product)
     return err
 }
 
-func SelectProduct(name string) (models.Product, error) {
+func SelectProduct(ctx context.Context, name string) (models.Product, error) {
     var product models.Product
-    collection := client.Database("product").Collection("product_collection")
-    err := collection.FindOne(context.TODO(), bson.D{{"itemcode", name}}).Decode(&product)
+    collection := database(ctx).Collection("product_collection")
+    err := collection.FindOne(ctx, bson.D{{Key: "itemcode", Value: name}}).Decode(&product)
     return product, err
 }
 
-func UpdateProduct(product models.Product) error {
-    collection := client.Database("product").Collection("product_collection")
-    filter := bson.D{{"itemcode", product.ItemCode}}
-    update := bson.D{{"$set", product}}
-    _, err := collection.UpdateOne(context.TODO(), filter, update)
+// SelectProducts returns the whole catalog.
+func SelectProducts(ctx context.Context) ([]models.Product, error) {
+    collection := database(ctx).Collection("product_collection")
+    cursor, err := collection.Find(ctx, bson.D{})
+    if err != nil {
+        return nil, err
+    }
+    var products []models.Product
+    err = cursor.All(ctx, &products)
+    return products, err
+}
+
+func UpdateProduct(ctx context.Context, product models.Product) error {
+    collection := database(ctx).Collection("product_collection")
+    filter := bson.D{{Key: "itemcode", Value: product.ItemCode}}
+    update := bson.D{{Key: "$set", Value: product}}
+    _, err := collection.UpdateOne(ctx, filter, update)
     return err
 }
 
-func DeleteProduct(name string) error {
-    collection := client.Database("product").Collection("product_collection")
+// DeleteProduct deletes a product and returns it as it was before deletion.
+func DeleteProduct(ctx context.Context, name string) (models.Product, error) {
+    var product models.Product
+    collection := database(ctx).Collection("product_collection")
 	fmt.Print("name ",name)
-    _, err := collection.DeleteOne(context.TODO(), bson.D{{"itemcode", name}})
-    return err
+    err := collection.FindOneAndDelete(ctx, bson.D{{Key: "itemcode", Value: name}}).Decode(&product)
+    return product, err
 }
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"product-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func InsertPurchaseOrder(ctx context.Context, purchaseOrder models.PurchaseOrder) error {
+	collection := database(ctx).Collection("purchase_order_collection")
+	_, err := collection.InsertOne(ctx, purchaseOrder)
+	return err
+}
+
+func SelectPurchaseOrder(ctx context.Context, poID string) (models.PurchaseOrder, error) {
+	var purchaseOrder models.PurchaseOrder
+	collection := database(ctx).Collection("purchase_order_collection")
+	err := collection.FindOne(ctx, bson.D{{Key: "poid", Value: poID}}).Decode(&purchaseOrder)
+	return purchaseOrder, err
+}
+
+// UpdatePurchaseOrder saves purchaseOrder if the stored order is still at
+// previousVersion, so two concurrent changes of the same order cannot both
+// succeed. It reports whether the order was updated.
+func UpdatePurchaseOrder(ctx context.Context, purchaseOrder models.PurchaseOrder, previousVersion int) (bool, error) {
+	collection := database(ctx).Collection("purchase_order_collection")
+	filter := bson.D{{Key: "poid", Value: purchaseOrder.POID}, {Key: "version", Value: previousVersion}}
+	update := bson.D{{Key: "$set", Value: purchaseOrder}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func InsertGoodsReceipt(ctx context.Context, goodsReceipt models.GoodsReceipt) error {
+	collection := database(ctx).Collection("goods_receipt_collection")
+	_, err := collection.InsertOne(ctx, goodsReceipt)
+	return err
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"product-service/models"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// refundReceiptIndexedDatabases remembers the databases whose refund
+// receipt index exists.
+var refundReceiptIndexedDatabases sync.Map
+
+// refundReceiptCollection returns the refund receipts of the tenant carried
+// by ctx, creating their unique index the first time it is used.
+func refundReceiptCollection(ctx context.Context) (*mongo.Collection, error) {
+	db := database(ctx)
+	collection := db.Collection("refund_receipt_collection")
+	if _, ok := refundReceiptIndexedDatabases.Load(db.Name()); ok {
+		return collection, nil
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "storeid", Value: 1}, {Key: "receiptno", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create refund receipt index in %s: %w", db.Name(), err)
+	}
+	refundReceiptIndexedDatabases.Store(db.Name(), true)
+	return collection, nil
+}
+
+func InsertRefund(ctx context.Context, refund models.Refund) error {
+	collection := database(ctx).Collection("refund_collection")
+	_, err := collection.InsertOne(ctx, refund)
+	return err
+}
+
+func SelectRefund(ctx context.Context, refundID string) (models.Refund, error) {
+	var refund models.Refund
+	collection := database(ctx).Collection("refund_collection")
+	err := collection.FindOne(ctx, bson.D{{Key: "refundid", Value: refundID}}).Decode(&refund)
+	return refund, err
+}
+
+// SelectRefundsByReceipt returns every refund recorded against a receipt of
+// a store, regardless of its status.
+func SelectRefundsByReceipt(ctx context.Context, storeID, receiptNo string) ([]models.Refund, error) {
+	collection := database(ctx).Collection("refund_collection")
+	filter := bson.D{{Key: "storeid", Value: storeID}, {Key: "receiptno", Value: receiptNo}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var refunds []models.Refund
+	err = cursor.All(ctx, &refunds)
+	return refunds, err
+}
+
+// UpdateRefund saves the decision on a refund that is still pending
+// approval, so two concurrent decisions on the same refund cannot both
+// succeed. It reports whether the refund was updated.
+func UpdateRefund(ctx context.Context, refund models.Refund) (bool, error) {
+	collection := database(ctx).Collection("refund_collection")
+	filter := bson.D{{Key: "refundid", Value: refund.RefundID}, {Key: "status", Value: models.RefundStatusPendingApproval}}
+	update := bson.D{{Key: "$set", Value: refund}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func SelectRefundReceipt(ctx context.Context, storeID, receiptNo string) (models.RefundReceipt, error) {
+	var receipt models.RefundReceipt
+	collection, err := refundReceiptCollection(ctx)
+	if err != nil {
+		return receipt, err
+	}
+	filter := bson.D{{Key: "storeid", Value: storeID}, {Key: "receiptno", Value: receiptNo}}
+	err = collection.FindOne(ctx, filter).Decode(&receipt)
+	return receipt, err
+}
+
+// SaveRefundReceipt saves receipt if the stored one is still at
+// previousVersion, or inserts it when previousVersion is 0, so two
+// concurrent refunds of the same receipt cannot both succeed. It reports
+// whether the receipt was saved.
+func SaveRefundReceipt(ctx context.Context, receipt models.RefundReceipt, previousVersion int) (bool, error) {
+	collection, err := refundReceiptCollection(ctx)
+	if err != nil {
+		return false, err
+	}
+	if previousVersion == 0 {
+		_, err = collection.InsertOne(ctx, receipt)
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	filter := bson.D{
+		{Key: "storeid", Value: receipt.StoreID},
+		{Key: "receiptno", Value: receipt.ReceiptNo},
+		{Key: "version", Value: previousVersion},
+	}
+	update := bson.D{{Key: "$set", Value: receipt}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"product-service/models"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// shiftIndexedDatabases remembers the databases whose shift index exists.
+var shiftIndexedDatabases sync.Map
+
+// shiftCollection returns the shifts of the tenant carried by ctx, creating
+// the index that allows one open shift per terminal the first time it is
+// used.
+func shiftCollection(ctx context.Context) (*mongo.Collection, error) {
+	db := database(ctx)
+	collection := db.Collection("shift_collection")
+	if _, ok := shiftIndexedDatabases.Load(db.Name()); ok {
+		return collection, nil
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "storeid", Value: 1}, {Key: "terminalid", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "status", Value: models.ShiftStatusOpen}}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create shift index in %s: %w", db.Name(), err)
+	}
+	shiftIndexedDatabases.Store(db.Name(), true)
+	return collection, nil
+}
+
+// InsertShift stores a new shift. Opening a second shift on a terminal
+// fails with a duplicate key error.
+func InsertShift(ctx context.Context, shift models.Shift) error {
+	collection, err := shiftCollection(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = collection.InsertOne(ctx, shift)
+	return err
+}
+
+func SelectShift(ctx context.Context, shiftID string) (models.Shift, error) {
+	var shift models.Shift
+	collection := database(ctx).Collection("shift_collection")
+	err := collection.FindOne(ctx, bson.D{{Key: "shiftid", Value: shiftID}}).Decode(&shift)
+	return shift, err
+}
+
+// SelectOpenShift returns the shift currently open on a terminal of a store.
+func SelectOpenShift(ctx context.Context, storeID, terminalID string) (models.Shift, error) {
+	var shift models.Shift
+	collection := database(ctx).Collection("shift_collection")
+	filter := bson.D{
+		{Key: "storeid", Value: storeID},
+		{Key: "terminalid", Value: terminalID},
+		{Key: "status", Value: models.ShiftStatusOpen},
+	}
+	err := collection.FindOne(ctx, filter).Decode(&shift)
+	return shift, err
+}
+
+// AppendCashMovement adds a cash movement to a shift that is still open and
+// returns the updated shift. mongo.ErrNoDocuments means the shift is missing
+// or already closed.
+func AppendCashMovement(ctx context.Context, shiftID string, movement models.CashMovement) (models.Shift, error) {
+	return pushToOpenShift(ctx, shiftID, "cashmovements", movement)
+}
+
+// AppendTaking adds a taking to a shift that is still open and returns the
+// updated shift. mongo.ErrNoDocuments means the shift is missing or already
+// closed.
+func AppendTaking(ctx context.Context, shiftID string, taking models.Taking) (models.Shift, error) {
+	return pushToOpenShift(ctx, shiftID, "takings", taking)
+}
+
+// CloseShift stores the closing figures of a shift that is still open and
+// has the takings and cash movements of shift, which they were worked out
+// from. mongo.ErrNoDocuments means the shift is missing, already closed, or
+// recorded more since it was read.
+func CloseShift(ctx context.Context, shift models.Shift) error {
+	collection := database(ctx).Collection("shift_collection")
+	filter := bson.D{
+		{Key: "shiftid", Value: shift.ShiftID},
+		{Key: "status", Value: models.ShiftStatusOpen},
+		{Key: "takings", Value: bson.D{{Key: "$size", Value: len(shift.Takings)}}},
+		{Key: "cashmovements", Value: bson.D{{Key: "$size", Value: len(shift.CashMovements)}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: shift.Status},
+		{Key: "expectedcash", Value: shift.ExpectedCash},
+		{Key: "countedcash", Value: shift.CountedCash},
+		{Key: "overshort", Value: shift.OverShort},
+		{Key: "closedat", Value: shift.ClosedAt},
+	}}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func pushToOpenShift(ctx context.Context, shiftID, field string, value interface{}) (models.Shift, error) {
+	var shift models.Shift
+	collection := database(ctx).Collection("shift_collection")
+	filter := bson.D{{Key: "shiftid", Value: shiftID}, {Key: "status", Value: models.ShiftStatusOpen}}
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: field, Value: value}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&shift)
+	return shift, err
+}
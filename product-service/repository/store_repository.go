@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"product-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func InsertStore(ctx context.Context, store models.Store) error {
+	collection := database(ctx).Collection("store_collection")
+	_, err := collection.InsertOne(ctx, store)
+	return err
+}
+
+func SelectStore(ctx context.Context, storeID string) (models.Store, error) {
+	var store models.Store
+	collection := database(ctx).Collection("store_collection")
+	err := collection.FindOne(ctx, bson.D{{Key: "storeid", Value: storeID}}).Decode(&store)
+	return store, err
+}
+
+func UpdateStore(ctx context.Context, store models.Store) error {
+	collection := database(ctx).Collection("store_collection")
+	filter := bson.D{{Key: "storeid", Value: store.StoreID}}
+	update := bson.D{{Key: "$set", Value: store}}
+	_, err := collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func SelectStoreProduct(ctx context.Context, storeID, itemCode string) (models.StoreProduct, error) {
+	var storeProduct models.StoreProduct
+	collection := database(ctx).Collection("store_product_collection")
+	filter := bson.D{{Key: "storeid", Value: storeID}, {Key: "itemcode", Value: itemCode}}
+	err := collection.FindOne(ctx, filter).Decode(&storeProduct)
+	return storeProduct, err
+}
+
+// UpsertStoreProduct replaces the store override for a product, creating it
+// when the store had none.
+func UpsertStoreProduct(ctx context.Context, storeProduct models.StoreProduct) error {
+	collection := database(ctx).Collection("store_product_collection")
+	filter := bson.D{{Key: "storeid", Value: storeProduct.StoreID}, {Key: "itemcode", Value: storeProduct.ItemCode}}
+	_, err := collection.ReplaceOne(ctx, filter, storeProduct, options.Replace().SetUpsert(true))
+	return err
+}
+
+// SelectStoreProducts returns every override of a store.
+func SelectStoreProducts(ctx context.Context, storeID string) ([]models.StoreProduct, error) {
+	collection := database(ctx).Collection("store_product_collection")
+	cursor, err := collection.Find(ctx, bson.D{{Key: "storeid", Value: storeID}})
+	if err != nil {
+		return nil, err
+	}
+	var storeProducts []models.StoreProduct
+	err = cursor.All(ctx, &storeProducts)
+	return storeProducts, err
+}
+
+// SelectItemStoreProducts returns every store override of a product.
+func SelectItemStoreProducts(ctx context.Context, itemCode string) ([]models.StoreProduct, error) {
+	collection := database(ctx).Collection("store_product_collection")
+	cursor, err := collection.Find(ctx, bson.D{{Key: "itemcode", Value: itemCode}})
+	if err != nil {
+		return nil, err
+	}
+	var storeProducts []models.StoreProduct
+	err = cursor.All(ctx, &storeProducts)
+	return storeProducts, err
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"product-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func InsertSupplier(ctx context.Context, supplier models.Supplier) error {
+	collection := database(ctx).Collection("supplier_collection")
+	_, err := collection.InsertOne(ctx, supplier)
+	return err
+}
+
+func SelectSupplier(ctx context.Context, supplierID string) (models.Supplier, error) {
+	var supplier models.Supplier
+	collection := database(ctx).Collection("supplier_collection")
+	err := collection.FindOne(ctx, bson.D{{Key: "supplierid", Value: supplierID}}).Decode(&supplier)
+	return supplier, err
+}
+
+func UpdateSupplier(ctx context.Context, supplier models.Supplier) error {
+	collection := database(ctx).Collection("supplier_collection")
+	filter := bson.D{{Key: "supplierid", Value: supplier.SupplierID}}
+	update := bson.D{{Key: "$set", Value: supplier}}
+	_, err := collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func SelectSupplierProducts(ctx context.Context, supplierID string) ([]models.SupplierProduct, error) {
+	collection := database(ctx).Collection("supplier_product_collection")
+	cursor, err := collection.Find(ctx, bson.D{{Key: "supplierid", Value: supplierID}})
+	if err != nil {
+		return nil, err
+	}
+	supplierProducts := []models.SupplierProduct{}
+	err = cursor.All(ctx, &supplierProducts)
+	return supplierProducts, err
+}
+
+func SelectSupplierProduct(ctx context.Context, supplierID, itemCode string) (models.SupplierProduct, error) {
+	var supplierProduct models.SupplierProduct
+	collection := database(ctx).Collection("supplier_product_collection")
+	filter := bson.D{{Key: "supplierid", Value: supplierID}, {Key: "itemcode", Value: itemCode}}
+	err := collection.FindOne(ctx, filter).Decode(&supplierProduct)
+	return supplierProduct, err
+}
+
+// UpsertSupplierProduct replaces the link between a supplier and a product,
+// creating it when there was none.
+func UpsertSupplierProduct(ctx context.Context, supplierProduct models.SupplierProduct) error {
+	collection := database(ctx).Collection("supplier_product_collection")
+	filter := bson.D{{Key: "supplierid", Value: supplierProduct.SupplierID}, {Key: "itemcode", Value: supplierProduct.ItemCode}}
+	_, err := collection.ReplaceOne(ctx, filter, supplierProduct, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"product-service/models"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const catalogChangeCounter = "catalog_change"
+
+// CatalogChangeGrace bounds how long an allocated sequence number may stay
+// pending. A writer that died between allocating and inserting its change
+// would otherwise hold back every later change for good, so pending numbers
+// older than this are ignored and dropped.
+const CatalogChangeGrace = time.Minute
+
+// catalogChangeCounterDoc is the counter of a tenant. Pending lists the
+// numbers allocated whose change is not inserted yet.
+type catalogChangeCounterDoc struct {
+	Seq     int64                  `bson:"seq"`
+	Pending []pendingCatalogChange `bson:"pending"`
+}
+
+// pendingCatalogChange is a sequence number handed out at At whose change
+// is still being written.
+type pendingCatalogChange struct {
+	Seq int64     `bson:"seq"`
+	At  time.Time `bson:"at"`
+}
+
+// syncIndexedDatabases remembers the databases whose sync indexes exist.
+var syncIndexedDatabases sync.Map
+
+// syncDatabase returns the tenant database like database, creating the
+// indexes of the sync collections the first time it is used.
+func syncDatabase(ctx context.Context) (*mongo.Database, error) {
+	db := database(ctx)
+	if _, ok := syncIndexedDatabases.Load(db.Name()); ok {
+		return db, nil
+	}
+	_, err := db.Collection("catalog_change_collection").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "storeid", Value: 1}, {Key: "seq", Value: 1}}},
+		{Keys: bson.D{{Key: "itemcode", Value: 1}, {Key: "seq", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create catalog change indexes in %s: %w", db.Name(), err)
+	}
+	_, err = db.Collection("sync_op_collection").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "storeid", Value: 1}, {Key: "result.opid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create sync op index in %s: %w", db.Name(), err)
+	}
+	syncIndexedDatabases.Store(db.Name(), true)
+	return db, nil
+}
+
+// NextCatalogChangeSeq allocates the sequence number of a new catalog change
+// and marks it pending until CompleteCatalogChange is called with it.
+func NextCatalogChangeSeq(ctx context.Context) (int64, error) {
+	db, err := syncDatabase(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var counter catalogChangeCounterDoc
+	collection := db.Collection("counter_collection")
+	filter := bson.D{{Key: "_id", Value: catalogChangeCounter}}
+	// A pipeline update, so the pending entry can name the new number
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "seq", Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$seq", int64(0)}}}, int64(1)}}}}}}},
+		{{Key: "$set", Value: bson.D{{Key: "pending", Value: bson.D{{Key: "$concatArrays", Value: bson.A{
+			bson.D{{Key: "$ifNull", Value: bson.A{"$pending", bson.A{}}}},
+			bson.A{bson.D{{Key: "seq", Value: "$seq"}, {Key: "at", Value: time.Now().UTC()}}},
+		}}}}}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	return counter.Seq, err
+}
+
+// CompleteCatalogChange clears seq from the pending numbers once its change
+// is inserted or abandoned, along with any pending number past the grace.
+func CompleteCatalogChange(ctx context.Context, seq int64) error {
+	collection := database(ctx).Collection("counter_collection")
+	filter := bson.D{{Key: "_id", Value: catalogChangeCounter}}
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "pending", Value: bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "seq", Value: seq}},
+		bson.D{{Key: "at", Value: bson.D{{Key: "$lt", Value: time.Now().UTC().Add(-CatalogChangeGrace)}}}},
+	}}}}}}}
+	_, err := collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// CatalogChangeHorizon returns the sequence number of the latest allocated
+// catalog change and the highest one below which every change is inserted,
+// or 0 for both when nothing changed yet. Changes are only served up to
+// visible, so a checkpoint never passes a change still being written.
+func CatalogChangeHorizon(ctx context.Context) (current, visible int64, err error) {
+	var counter catalogChangeCounterDoc
+	collection := database(ctx).Collection("counter_collection")
+	err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: catalogChangeCounter}}).Decode(&counter)
+	if err == mongo.ErrNoDocuments {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return counter.Seq, visibleSeq(counter, time.Now()), nil
+}
+
+// visibleSeq returns the highest sequence number of counter below the
+// lowest number still pending within the grace.
+func visibleSeq(counter catalogChangeCounterDoc, now time.Time) int64 {
+	visible := counter.Seq
+	cutoff := now.Add(-CatalogChangeGrace)
+	for _, pending := range counter.Pending {
+		if pending.At.After(cutoff) && pending.Seq-1 < visible {
+			visible = pending.Seq - 1
+		}
+	}
+	return visible
+}
+
+func InsertCatalogChange(ctx context.Context, change models.CatalogChange) error {
+	collection := database(ctx).Collection("catalog_change_collection")
+	_, err := collection.InsertOne(ctx, change)
+	return err
+}
+
+// storeChangesFilter matches the changes affecting storeID whose seq meets
+// the seq condition.
+func storeChangesFilter(storeID string, seq bson.D) bson.D {
+	return bson.D{
+		{Key: "seq", Value: seq},
+		{Key: "storeid", Value: bson.D{{Key: "$in", Value: bson.A{"", storeID}}}},
+	}
+}
+
+// SelectCatalogChanges returns up to limit changes affecting storeID after
+// afterSeq and up to uptoSeq, oldest first.
+func SelectCatalogChanges(ctx context.Context, storeID string, afterSeq, uptoSeq int64, limit int64) ([]models.CatalogChange, error) {
+	collection := database(ctx).Collection("catalog_change_collection")
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(limit)
+	seq := bson.D{{Key: "$gt", Value: afterSeq}, {Key: "$lte", Value: uptoSeq}}
+	cursor, err := collection.Find(ctx, storeChangesFilter(storeID, seq), opts)
+	if err != nil {
+		return nil, err
+	}
+	changes := []models.CatalogChange{}
+	err = cursor.All(ctx, &changes)
+	return changes, err
+}
+
+// HasCatalogChangeSince reports whether a product changed for storeID after
+// afterSeq through anyone but terminalID.
+func HasCatalogChangeSince(ctx context.Context, storeID, itemCode string, afterSeq int64, terminalID string) (bool, error) {
+	collection := database(ctx).Collection("catalog_change_collection")
+	filter := conflictingChangesFilter(storeID, itemCode, afterSeq, terminalID)
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// conflictingChangesFilter matches the changes HasCatalogChangeSince looks
+// for.
+func conflictingChangesFilter(storeID, itemCode string, afterSeq int64, terminalID string) bson.D {
+	return append(storeChangesFilter(storeID, bson.D{{Key: "$gt", Value: afterSeq}}),
+		bson.E{Key: "itemcode", Value: itemCode},
+		bson.E{Key: "terminalid", Value: bson.D{{Key: "$ne", Value: terminalID}}},
+	)
+}
+
+func SelectSyncOp(ctx context.Context, storeID, opID string) (models.SyncOpRecord, error) {
+	var record models.SyncOpRecord
+	collection := database(ctx).Collection("sync_op_collection")
+	filter := bson.D{{Key: "storeid", Value: storeID}, {Key: "result.opid", Value: opID}}
+	err := collection.FindOne(ctx, filter).Decode(&record)
+	return record, err
+}
+
+// ClaimSyncOp records that the operation of record is being applied. It
+// reports false when the store already has a record of the operation, so
+// two pushes of the same operation cannot both apply it.
+func ClaimSyncOp(ctx context.Context, record models.SyncOpRecord) (bool, error) {
+	db, err := syncDatabase(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, err = db.Collection("sync_op_collection").InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CompleteSyncOp stores the outcome of a claimed operation.
+func CompleteSyncOp(ctx context.Context, storeID string, result models.SyncOpResult) error {
+	collection := database(ctx).Collection("sync_op_collection")
+	filter := bson.D{{Key: "storeid", Value: storeID}, {Key: "result.opid", Value: result.OpID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "result", Value: result}, {Key: "recordedat", Value: time.Now().UTC()}}}}
+	_, err := collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// ReleaseSyncOp drops the claim on an operation that is still pending and
+// was recorded at recordedAt, so it can be pushed again.
+func ReleaseSyncOp(ctx context.Context, storeID, opID string, recordedAt time.Time) error {
+	collection := database(ctx).Collection("sync_op_collection")
+	filter := bson.D{
+		{Key: "storeid", Value: storeID},
+		{Key: "result.opid", Value: opID},
+		{Key: "result.status", Value: models.SyncOpStatusPending},
+		{Key: "recordedat", Value: recordedAt},
+	}
+	_, err := collection.DeleteOne(ctx, filter)
+	return err
+}
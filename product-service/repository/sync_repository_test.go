@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVisibleSeq(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-CatalogChangeGrace / 2)
+	stale := now.Add(-2 * CatalogChangeGrace)
+	tests := []struct {
+		name    string
+		counter catalogChangeCounterDoc
+		want    int64
+	}{
+		{"no changes", catalogChangeCounterDoc{}, 0},
+		{"nothing pending", catalogChangeCounterDoc{Seq: 7}, 7},
+		{
+			name:    "latest pending",
+			counter: catalogChangeCounterDoc{Seq: 7, Pending: []pendingCatalogChange{{Seq: 7, At: recent}}},
+			want:    6,
+		},
+		{
+			name: "lowest pending holds back later ones",
+			counter: catalogChangeCounterDoc{Seq: 9, Pending: []pendingCatalogChange{
+				{Seq: 8, At: recent},
+				{Seq: 5, At: recent},
+			}},
+			want: 4,
+		},
+		{
+			name:    "stale pending ignored",
+			counter: catalogChangeCounterDoc{Seq: 9, Pending: []pendingCatalogChange{{Seq: 5, At: stale}}},
+			want:    9,
+		},
+		{
+			name: "stale and recent pending",
+			counter: catalogChangeCounterDoc{Seq: 9, Pending: []pendingCatalogChange{
+				{Seq: 3, At: stale},
+				{Seq: 6, At: recent},
+			}},
+			want: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visibleSeq(tt.counter, now); got != tt.want {
+				t.Errorf("visibleSeq = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictingChangesFilter(t *testing.T) {
+	// A change conflicts when it came after the base checkpoint, from
+	// another terminal, to the product in the store or in the master data.
+	want := bson.D{
+		{Key: "seq", Value: bson.D{{Key: "$gt", Value: int64(12)}}},
+		{Key: "storeid", Value: bson.D{{Key: "$in", Value: bson.A{"", "S1"}}}},
+		{Key: "itemcode", Value: "A1"},
+		{Key: "terminalid", Value: bson.D{{Key: "$ne", Value: "T1"}}},
+	}
+	if got := conflictingChangesFilter("S1", "A1", 12, "T1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("conflictingChangesFilter = %v, want %v", got, want)
+	}
+}
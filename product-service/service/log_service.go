@@ -0,0 +1,36 @@
+package service
+
+import (
+	"common/requestid"
+	"common/topology"
+	"context"
+	"encoding/json"
+	"product-service/models"
+	"time"
+)
+
+const serviceName = "product-service"
+
+// NewLogEntry returns a log entry of this service stamped with the current
+// time.
+func NewLogEntry(level, message string) models.LogEntry {
+	return models.LogEntry{
+		Time:    time.Now().UTC(),
+		Service: serviceName,
+		Level:   level,
+		Message: message,
+	}
+}
+
+// PublishLog writes entry to the logging queue, routed by its level. Entries
+// without a correlation ID take the one of the request.
+func PublishLog(ctx context.Context, entry models.LogEntry) error {
+	if entry.CorrelationID == "" {
+		entry.CorrelationID = requestid.FromContext(ctx)
+	}
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return publishToExchange(ctx, topology.ErrorExchange, topology.LoggingKey(entry.Level), true, entryJSON)
+}
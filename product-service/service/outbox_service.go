@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"product-service/metrics"
+	"product-service/models"
+	"product-service/repository"
+	"product-service/utils"
+	"time"
+
+	"common/requestid"
+	"common/tracing"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// outboxLease is how long a message is left to its publisher before
+	// the relay publishes it again.
+	outboxLease = 30 * time.Second
+	// outboxRelayInterval is how often the relay looks for messages whose
+	// publish failed.
+	outboxRelayInterval = 5 * time.Second
+)
+
+// publishStateChange publishes event, JSON encoded, for a change that is
+// already stored. The event is kept in the tenant's outbox until the broker
+// confirms it, and RunOutboxRelay publishes it again when this publish
+// fails, so the caller reports the change as done either way.
+func publishStateChange(ctx context.Context, exchange, routingKey string, mandatory bool, event interface{}) {
+	ctx, span := tracing.StartPublish(ctx, exchange, routingKey)
+	defer span.End()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		requestid.Logf(ctx, "Failed to encode %s: %v", routingKey, err)
+		return
+	}
+
+	headers := MessageHeaders(ctx)
+	now := time.Now().UTC()
+	message := models.OutboxMessage{
+		ID:            primitive.NewObjectID(),
+		Exchange:      exchange,
+		RoutingKey:    routingKey,
+		Mandatory:     mandatory,
+		Headers:       make(map[string]string, len(headers)),
+		Body:          body,
+		CreatedAt:     now,
+		Attempts:      1,
+		NextAttemptAt: now.Add(outboxLease),
+	}
+	for key, value := range headers {
+		message.Headers[key] = fmt.Sprint(value)
+	}
+	stored := true
+	if err := repository.InsertOutboxMessage(ctx, message); err != nil {
+		requestid.Logf(ctx, "Failed to store %s in the outbox, publishing it without: %v", routingKey, err)
+		stored = false
+	}
+
+	err = publishWithHeaders(ctx, exchange, routingKey, mandatory, headers, body)
+	metrics.ObservePublish(exchange, routingKey, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if stored {
+			requestid.Logf(ctx, "Failed to publish %s, the outbox relay retries it: %v", routingKey, err)
+		} else {
+			requestid.Logf(ctx, "Failed to publish %s, the event is lost: %v", routingKey, err)
+		}
+		return
+	}
+	log.Printf(" [x] Sent %s: %s", routingKey, body)
+	if stored {
+		if err := repository.DeleteOutboxMessage(context.WithoutCancel(ctx), message.ID); err != nil {
+			requestid.Logf(ctx, "Failed to clear %s from the outbox, it will be published again: %v", routingKey, err)
+		}
+	}
+}
+
+// RunOutboxRelay publishes the outbox messages of every tenant whose publish
+// failed, until ctx is done.
+func RunOutboxRelay(ctx context.Context) {
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tenantIDs, err := repository.SelectTenantIDs(ctx)
+		if err != nil {
+			log.Printf("Outbox relay failed to list tenants: %v", err)
+			continue
+		}
+		for _, tenantID := range tenantIDs {
+			relayOutbox(utils.WithTenantID(ctx, tenantID))
+		}
+	}
+}
+
+// relayOutbox publishes the due messages of one tenant's outbox. It stops at
+// the first failure, as the next one would most likely fail too.
+func relayOutbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		message, err := repository.ClaimOutboxMessage(ctx, outboxLease)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			log.Printf("Outbox relay failed to read tenant %q: %v", utils.TenantIDFromContext(ctx), err)
+			return
+		}
+
+		headers := make(amqp091.Table, len(message.Headers))
+		for key, value := range message.Headers {
+			headers[key] = value
+		}
+		err = publishWithHeaders(ctx, message.Exchange, message.RoutingKey, message.Mandatory, headers, message.Body)
+		metrics.ObservePublish(message.Exchange, message.RoutingKey, err)
+		if err != nil {
+			log.Printf("Outbox relay failed to publish %s (attempt %d): %v", message.RoutingKey, message.Attempts, err)
+			return
+		}
+		log.Printf("Outbox relay sent %s after %d attempts", message.RoutingKey, message.Attempts)
+		if err := repository.DeleteOutboxMessage(ctx, message.ID); err != nil {
+			log.Printf("Outbox relay failed to clear %s: %v", message.RoutingKey, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"product-service/repository"
+	"product-service/utils"
+	"time"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidPurchaseOrder = errors.New("invalid purchase order")
+	ErrInvalidTransition    = errors.New("purchase order cannot change to the requested status")
+	ErrConcurrentUpdate     = errors.New("purchase order was changed concurrently, retry")
+)
+
+// purchaseOrderTransitions lists the statuses a purchase order may change to
+// from each status. Closed orders do not change any more.
+var purchaseOrderTransitions = map[string][]string{
+	models.PurchaseOrderStatusDraft:             {models.PurchaseOrderStatusSent, models.PurchaseOrderStatusClosed},
+	models.PurchaseOrderStatusSent:              {models.PurchaseOrderStatusPartiallyReceived, models.PurchaseOrderStatusClosed},
+	models.PurchaseOrderStatusPartiallyReceived: {models.PurchaseOrderStatusPartiallyReceived, models.PurchaseOrderStatusClosed},
+}
+
+// canTransition reports whether a purchase order in status from may change
+// to status to.
+func canTransition(from, to string) bool {
+	for _, status := range purchaseOrderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePurchaseOrder records a draft purchase order of the requesting store.
+// Lines without a cost price take the one quoted by the supplier.
+func CreatePurchaseOrder(ctx context.Context, purchaseOrder models.PurchaseOrder) (models.PurchaseOrder, error) {
+	purchaseOrder.StoreID = utils.StoreIDFromContext(ctx)
+	if len(purchaseOrder.Lines) == 0 {
+		return purchaseOrder, fmt.Errorf("%w: at least one line is required", ErrInvalidPurchaseOrder)
+	}
+
+	supplier, err := repository.SelectSupplier(ctx, purchaseOrder.SupplierID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return purchaseOrder, fmt.Errorf("%w: unknown supplier %s", ErrInvalidPurchaseOrder, purchaseOrder.SupplierID)
+		}
+		return purchaseOrder, err
+	}
+	if !supplier.Active {
+		return purchaseOrder, fmt.Errorf("%w: supplier %s is not active", ErrInvalidPurchaseOrder, supplier.SupplierID)
+	}
+
+	purchaseOrder.Total = 0
+	for i := range purchaseOrder.Lines {
+		line := &purchaseOrder.Lines[i]
+		if line.Quantity <= 0 {
+			return purchaseOrder, fmt.Errorf("%w: quantity for %s must be positive", ErrInvalidPurchaseOrder, line.ItemCode)
+		}
+		supplierProduct, err := repository.SelectSupplierProduct(ctx, supplier.SupplierID, line.ItemCode)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return purchaseOrder, fmt.Errorf("%w: supplier %s does not deliver %s", ErrInvalidPurchaseOrder, supplier.SupplierID, line.ItemCode)
+			}
+			return purchaseOrder, err
+		}
+		if line.CostPrice <= 0 {
+			line.CostPrice = supplierProduct.CostPrice
+		}
+		line.ReceivedQuantity = 0
+		purchaseOrder.Total += line.CostPrice * float64(line.Quantity)
+	}
+	purchaseOrder.Total = roundAmount(purchaseOrder.Total)
+
+	purchaseOrder.POID = primitive.NewObjectID().Hex()
+	purchaseOrder.Status = models.PurchaseOrderStatusDraft
+	purchaseOrder.CreatedAt = time.Now().UTC()
+	purchaseOrder.SentAt = nil
+	purchaseOrder.ExpectedAt = nil
+	purchaseOrder.ClosedAt = nil
+	purchaseOrder.Version = 1
+
+	if err := repository.InsertPurchaseOrder(ctx, purchaseOrder); err != nil {
+		return purchaseOrder, err
+	}
+	publishPurchaseOrderEvent(ctx, models.PurchaseOrderEvent{PurchaseOrder: purchaseOrder})
+	return purchaseOrder, nil
+}
+
+// SelectPurchaseOrder returns a purchase order of the requesting store.
+// Orders of other stores are reported as not found.
+func SelectPurchaseOrder(ctx context.Context, poID string) (models.PurchaseOrder, error) {
+	purchaseOrder, err := repository.SelectPurchaseOrder(ctx, poID)
+	if err == nil && purchaseOrder.StoreID != utils.StoreIDFromContext(ctx) {
+		return models.PurchaseOrder{}, mongo.ErrNoDocuments
+	}
+	return purchaseOrder, err
+}
+
+// SendPurchaseOrder marks a draft purchase order as sent to the supplier and
+// sets the expected delivery from the longest lead time of its lines.
+func SendPurchaseOrder(ctx context.Context, poID string) (models.PurchaseOrder, error) {
+	purchaseOrder, err := SelectPurchaseOrder(ctx, poID)
+	if err != nil {
+		return purchaseOrder, err
+	}
+	if !canTransition(purchaseOrder.Status, models.PurchaseOrderStatusSent) {
+		return purchaseOrder, ErrInvalidTransition
+	}
+
+	leadTimeDays := 0
+	for _, line := range purchaseOrder.Lines {
+		supplierProduct, err := repository.SelectSupplierProduct(ctx, purchaseOrder.SupplierID, line.ItemCode)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return purchaseOrder, err
+		}
+		leadTimeDays = max(leadTimeDays, supplierProduct.LeadTimeDays)
+	}
+
+	sentAt := time.Now().UTC()
+	expectedAt := sentAt.AddDate(0, 0, leadTimeDays)
+	purchaseOrder.SentAt = &sentAt
+	purchaseOrder.ExpectedAt = &expectedAt
+	return transitionPurchaseOrder(ctx, purchaseOrder, models.PurchaseOrderStatusSent, nil)
+}
+
+// ReceivePurchaseOrder posts a goods receipt against a sent purchase order.
+// The order closes once every line is fully received.
+func ReceivePurchaseOrder(ctx context.Context, goodsReceipt models.GoodsReceipt) (models.PurchaseOrder, error) {
+	purchaseOrder, err := SelectPurchaseOrder(ctx, goodsReceipt.POID)
+	if err != nil {
+		return purchaseOrder, err
+	}
+	// Receipts that complete the order close it, which is allowed
+	// wherever partial receipts are
+	if !canTransition(purchaseOrder.Status, models.PurchaseOrderStatusPartiallyReceived) {
+		return purchaseOrder, ErrInvalidTransition
+	}
+	status, err := receiveLines(&purchaseOrder, goodsReceipt.Lines)
+	if err != nil {
+		return purchaseOrder, err
+	}
+
+	goodsReceipt.ReceiptID = primitive.NewObjectID().Hex()
+	goodsReceipt.StoreID = purchaseOrder.StoreID
+	goodsReceipt.ReceivedAt = time.Now().UTC()
+	if status == models.PurchaseOrderStatusClosed {
+		closedAt := goodsReceipt.ReceivedAt
+		purchaseOrder.ClosedAt = &closedAt
+	}
+
+	purchaseOrder, err = transitionPurchaseOrder(ctx, purchaseOrder, status, &goodsReceipt)
+	if err != nil {
+		return purchaseOrder, err
+	}
+	return purchaseOrder, repository.InsertGoodsReceipt(ctx, goodsReceipt)
+}
+
+// receiveLines adds the received quantities to the lines of purchaseOrder
+// and returns the status it moves to: closed once every line is fully
+// received.
+func receiveLines(purchaseOrder *models.PurchaseOrder, received []models.GoodsReceiptLine) (string, error) {
+	if len(received) == 0 {
+		return "", fmt.Errorf("%w: at least one received line is required", ErrInvalidPurchaseOrder)
+	}
+
+	lines := make(map[string]*models.PurchaseOrderLine, len(purchaseOrder.Lines))
+	for i := range purchaseOrder.Lines {
+		lines[purchaseOrder.Lines[i].ItemCode] = &purchaseOrder.Lines[i]
+	}
+	for _, receivedLine := range received {
+		line, ok := lines[receivedLine.ItemCode]
+		if !ok {
+			return "", fmt.Errorf("%w: %s is not on the purchase order", ErrInvalidPurchaseOrder, receivedLine.ItemCode)
+		}
+		if receivedLine.Quantity <= 0 {
+			return "", fmt.Errorf("%w: received quantity for %s must be positive", ErrInvalidPurchaseOrder, receivedLine.ItemCode)
+		}
+		if line.ReceivedQuantity+receivedLine.Quantity > line.Quantity {
+			return "", fmt.Errorf("%w: %s would receive %d of %d ordered", ErrInvalidPurchaseOrder,
+				receivedLine.ItemCode, line.ReceivedQuantity+receivedLine.Quantity, line.Quantity)
+		}
+		line.ReceivedQuantity += receivedLine.Quantity
+	}
+
+	status := models.PurchaseOrderStatusClosed
+	for _, line := range purchaseOrder.Lines {
+		if line.ReceivedQuantity < line.Quantity {
+			status = models.PurchaseOrderStatusPartiallyReceived
+			break
+		}
+	}
+	return status, nil
+}
+
+// ClosePurchaseOrder closes a purchase order that will not receive any
+// further deliveries, whatever is still outstanding on it.
+func ClosePurchaseOrder(ctx context.Context, poID string) (models.PurchaseOrder, error) {
+	purchaseOrder, err := SelectPurchaseOrder(ctx, poID)
+	if err != nil {
+		return purchaseOrder, err
+	}
+	if !canTransition(purchaseOrder.Status, models.PurchaseOrderStatusClosed) {
+		return purchaseOrder, ErrInvalidTransition
+	}
+
+	closedAt := time.Now().UTC()
+	purchaseOrder.ClosedAt = &closedAt
+	return transitionPurchaseOrder(ctx, purchaseOrder, models.PurchaseOrderStatusClosed, nil)
+}
+
+// transitionPurchaseOrder saves purchaseOrder in its new status and publishes
+// the matching purchaseorder.<status> event.
+func transitionPurchaseOrder(ctx context.Context, purchaseOrder models.PurchaseOrder, status string, goodsReceipt *models.GoodsReceipt) (models.PurchaseOrder, error) {
+	previousStatus := purchaseOrder.Status
+	previousVersion := purchaseOrder.Version
+	purchaseOrder.Status = status
+	purchaseOrder.Version++
+
+	updated, err := repository.UpdatePurchaseOrder(ctx, purchaseOrder, previousVersion)
+	if err != nil {
+		return purchaseOrder, err
+	}
+	if !updated {
+		return purchaseOrder, ErrConcurrentUpdate
+	}
+
+	publishPurchaseOrderEvent(ctx, models.PurchaseOrderEvent{
+		PurchaseOrder:  purchaseOrder,
+		PreviousStatus: previousStatus,
+		GoodsReceipt:   goodsReceipt,
+	})
+	return purchaseOrder, nil
+}
+
+// publishPurchaseOrderEvent publishes the event of a stored purchase order
+// change, see publishStateChange.
+func publishPurchaseOrderEvent(ctx context.Context, event models.PurchaseOrderEvent) {
+	publishStateChange(ctx, topology.ProductExchange, topology.PurchaseOrderKey(event.PurchaseOrder.Status), true, event)
+}
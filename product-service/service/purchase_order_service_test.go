@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"product-service/models"
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	const (
+		draft    = models.PurchaseOrderStatusDraft
+		sent     = models.PurchaseOrderStatusSent
+		received = models.PurchaseOrderStatusPartiallyReceived
+		closed   = models.PurchaseOrderStatusClosed
+	)
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{draft, sent, true},
+		{draft, received, false},
+		{draft, closed, true},
+		{sent, draft, false},
+		{sent, sent, false},
+		{sent, received, true},
+		{sent, closed, true},
+		{received, sent, false},
+		{received, received, true},
+		{received, closed, true},
+		{closed, draft, false},
+		{closed, sent, false},
+		{closed, received, false},
+		{closed, closed, false},
+		{"", draft, false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestReceiveLines(t *testing.T) {
+	order := func() models.PurchaseOrder {
+		return models.PurchaseOrder{Lines: []models.PurchaseOrderLine{
+			{ItemCode: "A1", Quantity: 10, ReceivedQuantity: 4},
+			{ItemCode: "B2", Quantity: 5},
+		}}
+	}
+	tests := []struct {
+		name     string
+		received []models.GoodsReceiptLine
+
+		wantStatus   string
+		wantReceived []int
+		wantErr      string
+	}{
+		{
+			name:         "partial",
+			received:     []models.GoodsReceiptLine{{ItemCode: "A1", Quantity: 3}},
+			wantStatus:   models.PurchaseOrderStatusPartiallyReceived,
+			wantReceived: []int{7, 0},
+		},
+		{
+			name:         "completes the order",
+			received:     []models.GoodsReceiptLine{{ItemCode: "A1", Quantity: 6}, {ItemCode: "B2", Quantity: 5}},
+			wantStatus:   models.PurchaseOrderStatusClosed,
+			wantReceived: []int{10, 5},
+		},
+		{
+			name:         "one item in several lines",
+			received:     []models.GoodsReceiptLine{{ItemCode: "B2", Quantity: 2}, {ItemCode: "B2", Quantity: 3}},
+			wantStatus:   models.PurchaseOrderStatusPartiallyReceived,
+			wantReceived: []int{4, 5},
+		},
+		{
+			name:    "nothing received",
+			wantErr: "invalid purchase order: at least one received line is required",
+		},
+		{
+			name:     "more than ordered",
+			received: []models.GoodsReceiptLine{{ItemCode: "A1", Quantity: 7}},
+			wantErr:  "invalid purchase order: A1 would receive 11 of 10 ordered",
+		},
+		{
+			name:     "more than ordered over several lines",
+			received: []models.GoodsReceiptLine{{ItemCode: "B2", Quantity: 3}, {ItemCode: "B2", Quantity: 3}},
+			wantErr:  "invalid purchase order: B2 would receive 6 of 5 ordered",
+		},
+		{
+			name:     "not ordered",
+			received: []models.GoodsReceiptLine{{ItemCode: "C3", Quantity: 1}},
+			wantErr:  "invalid purchase order: C3 is not on the purchase order",
+		},
+		{
+			name:     "quantity not positive",
+			received: []models.GoodsReceiptLine{{ItemCode: "A1", Quantity: 0}},
+			wantErr:  "invalid purchase order: received quantity for A1 must be positive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purchaseOrder := order()
+			status, err := receiveLines(&purchaseOrder, tt.received)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr || !errors.Is(err, ErrInvalidPurchaseOrder) {
+					t.Fatalf("receiveLines = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("receiveLines: %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", status, tt.wantStatus)
+			}
+			var received []int
+			for _, line := range purchaseOrder.Lines {
+				received = append(received, line.ReceivedQuantity)
+			}
+			if !reflect.DeepEqual(received, tt.wantReceived) {
+				t.Errorf("received = %v, want %v", received, tt.wantReceived)
+			}
+		})
+	}
+}
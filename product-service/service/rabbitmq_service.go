@@ -1,38 +1,79 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"errors"
+	"time"
+	"product-service/metrics"
 	"product-service/models"
 	"product-service/repository"
+	"common/tracing"
+	"product-service/utils"
+	"common/requestid"
+
+	"common/rabbitmq"
+	"common/topology"
 
 	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/codes"
 )
 
-var rabbitMQChannel *amqp091.Channel
+var rabbitMQ *rabbitmq.Manager
+
+// InitRabbitMQ sets the connection manager messages are published through.
+// It swaps channels on reconnect, so publishers never hold a stale one.
+func InitRabbitMQ(manager *rabbitmq.Manager) {
+	rabbitMQ = manager
+}
+
+// MessageHeaders returns the AMQP headers that tie a message to the request
+// and trace it was published for.
+func MessageHeaders(ctx context.Context) amqp091.Table {
+	headers := amqp091.Table{}
+	tracing.Inject(ctx, headers)
+	if tenantID := utils.TenantIDFromContext(ctx); tenantID != "" {
+		headers["x-tenant-id"] = tenantID
+	}
+	if storeID := utils.StoreIDFromContext(ctx); storeID != "" {
+		headers["x-store-id"] = storeID
+	}
+	requestid.Inject(ctx, headers)
+	return headers
+}
+
+func publishToRabbitMQ(ctx context.Context, routingKey string, body []byte) error {
+	return publishToExchange(ctx, topology.ProductExchange, routingKey, true, body)
+}
 
-func InitRabbitMQ(channel *amqp091.Channel) {
-	rabbitMQChannel = channel
+// publishToExchange publishes body and waits for the broker to confirm it.
+// Mandatory messages that no queue is bound for fail with
+// rabbitmq.ErrUnroutable.
+func publishToExchange(ctx context.Context, exchange, routingKey string, mandatory bool, body []byte) error {
+	return publishToExchangeWith(ctx, exchange, routingKey, mandatory, nil, body)
 }
 
-func publishToRabbitMQ(routingKey string, body []byte) error {
-	if rabbitMQChannel == nil {
+// publishToExchangeWith is publishToExchange with extra headers added to the
+// ones of MessageHeaders.
+func publishToExchangeWith(ctx context.Context, exchange, routingKey string, mandatory bool, extra amqp091.Table, body []byte) error {
+	if rabbitMQ == nil {
 		return errors.New("RabbitMQ channel is not initialized")
 
 	}
 
-	err := rabbitMQChannel.Publish(
-		"product_exchange", // exchange
-		routingKey,         // routing key
-		false,              // mandatory
-		false,              // immediate
-		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+	ctx, span := tracing.StartPublish(ctx, exchange, routingKey)
+	defer span.End()
+
+	headers := MessageHeaders(ctx)
+	for key, value := range extra {
+		headers[key] = value
+	}
+	err := publishWithHeaders(ctx, exchange, routingKey, mandatory, headers, body)
+	metrics.ObservePublish(exchange, routingKey, err)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		log.Printf("Failed to publish message: %v", err)
 		return err
 	}
@@ -40,36 +81,104 @@ func publishToRabbitMQ(routingKey string, body []byte) error {
 	return nil
 }
 
-func PublishInsertProduct(product models.Product) error {
+// publishWithHeaders publishes body with the given headers and waits for the
+// broker to confirm it.
+func publishWithHeaders(ctx context.Context, exchange, routingKey string, mandatory bool, headers amqp091.Table, body []byte) error {
+	if rabbitMQ == nil {
+		return errors.New("RabbitMQ channel is not initialized")
+	}
+	return rabbitMQ.Publish(ctx,
+		exchange,   // exchange
+		routingKey, // routing key
+		mandatory,  // mandatory
+		amqp091.Publishing{
+			ContentType: "application/json",
+			Headers:     headers,
+			// Feed consumers replaying the event stream tell old events
+			// from new ones by it
+			Timestamp: time.Now().UTC(),
+			Body:      body,
+		},
+	)
+}
+
+func PublishInsertProduct(ctx context.Context, product models.Product) error {
+	return publishProductChange(ctx, topology.KeyProductInsert, product)
+}
+
+func PublishUpdateProduct(ctx context.Context, product models.Product) error {
+	return publishProductChange(ctx, topology.KeyProductUpdate, product)
+}
+
+// publishProductChange publishes a master product change with the store
+// overrides of the product in the x-store-overrides header, so the catalog
+// feed sends every store the product as it is sold there.
+func publishProductChange(ctx context.Context, routingKey string, product models.Product) error {
 	productJSON, err := json.Marshal(product)
 	if err != nil {
 		return err
 	}
-	return publishToRabbitMQ("product.insert", productJSON)
+	storeProducts, err := repository.SelectItemStoreProducts(ctx, product.ItemCode)
+	if err != nil {
+		return err
+	}
+	overridesJSON, err := json.Marshal(storeOverrides(storeProducts))
+	if err != nil {
+		return err
+	}
+	headers := amqp091.Table{"x-store-overrides": string(overridesJSON)}
+	return publishToExchangeWith(ctx, topology.ProductExchange, routingKey, true, headers, productJSON)
 }
 
-func PublishUpdateProduct(product models.Product) error {
-	productJSON, err := json.Marshal(product)
-	if err != nil {
+// storeOverrides returns the store products that change the price or
+// availability of a product.
+func storeOverrides(storeProducts []models.StoreProduct) []models.StoreProduct {
+	overrides := []models.StoreProduct{}
+	for _, storeProduct := range storeProducts {
+		if storeProduct.Price != nil || !storeProduct.Available {
+			overrides = append(overrides, storeProduct)
+		}
+	}
+	return overrides
+}
+
+func InsertProduct(ctx context.Context, product models.Product) error {
+	if err := repository.InsertProduct(ctx, product); err != nil {
 		return err
 	}
-	return publishToRabbitMQ("product.update", productJSON)
+	return recordCatalogChange(ctx, "", product.ItemCode)
 }
 
-func InsertProduct(product models.Product) error {
-	return repository.InsertProduct(product)
+func UpdateProduct(ctx context.Context, product models.Product) error {
+	if err := repository.UpdateProduct(ctx, product); err != nil {
+		return err
+	}
+	return recordCatalogChange(ctx, "", product.ItemCode)
 }
 
-func UpdateProduct(product models.Product) error {
-	return repository.UpdateProduct(product)
+func PublishDeleteProduct(ctx context.Context, product models.Product) error {
+	productJSON, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	// Deletes only reach feed subscribers, which may all be offline
+	return publishToExchange(ctx, topology.ProductExchange, topology.KeyProductDelete, false, productJSON)
 }
 
-func DeleteProduct(name string) error {
+func DeleteProduct(ctx context.Context, name string) (models.Product, error) {
 	// Directly delete product from MongoDB
-	return repository.DeleteProduct(name)
+	product, err := repository.DeleteProduct(ctx, name)
+	if err != nil {
+		return product, err
+	}
+	return product, recordCatalogChange(ctx, "", product.ItemCode)
 }
 
-func SelectProduct(name string) (models.Product, error) {
-	// Directly select product from MongoDB
-	return repository.SelectProduct(name)
+func SelectProduct(ctx context.Context, name string) (models.Product, error) {
+	// Select product from MongoDB as it is sold in the requesting store
+	product, err := repository.SelectProduct(ctx, name)
+	if err != nil {
+		return product, err
+	}
+	return applyStoreOverride(ctx, utils.StoreIDFromContext(ctx), product)
 }
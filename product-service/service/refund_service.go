@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"product-service/config"
+	"product-service/models"
+	"product-service/repository"
+	"product-service/utils"
+	"sort"
+	"time"
+
+	"common/requestid"
+	"common/topology"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidRefund       = errors.New("invalid refund")
+	ErrRefundNotPending    = errors.New("refund is not pending approval")
+	ErrApproverNotEligible = errors.New("approver is not eligible")
+	// ErrApproverNotAuthenticated is returned when a refund approval does
+	// not carry a valid manager token.
+	ErrApproverNotAuthenticated = errors.New("manager token is missing or invalid")
+	// ErrConcurrentRefund is returned when other refunds of the same
+	// receipt kept changing it while a refund was recorded.
+	ErrConcurrentRefund = errors.New("receipt was refunded concurrently, retry")
+)
+
+// refundReceiptAttempts bounds how often a refund is checked again against
+// a receipt that another refund changed in the meantime.
+const refundReceiptAttempts = 3
+
+// CreateRefund values the returned lines at the current price in the
+// requesting store and records the refund. Refunds above the approval
+// threshold are held until a manager approves them, all others complete
+// straight away.
+func CreateRefund(ctx context.Context, refund models.Refund) (models.Refund, error) {
+	refund.StoreID = utils.StoreIDFromContext(ctx)
+	if refund.ReceiptNo == "" {
+		return refund, fmt.Errorf("%w: receiptno is required", ErrInvalidRefund)
+	}
+	if refund.RequestedBy == "" {
+		return refund, fmt.Errorf("%w: requestedby is required", ErrInvalidRefund)
+	}
+	if len(refund.Lines) == 0 {
+		return refund, fmt.Errorf("%w: at least one line is required", ErrInvalidRefund)
+	}
+
+	if err := reserveRefund(ctx, &refund); err != nil {
+		return refund, err
+	}
+
+	refund.RefundID = primitive.NewObjectID().Hex()
+	refund.ApprovedBy = ""
+	refund.CreatedAt = time.Now().UTC()
+	refund.CompletedAt = nil
+	refund.Status = models.RefundStatusPendingApproval
+	if refund.Total <= config.GetRefundApprovalThreshold() {
+		completedAt := refund.CreatedAt
+		refund.Status = models.RefundStatusCompleted
+		refund.CompletedAt = &completedAt
+	}
+
+	if err := repository.InsertRefund(ctx, refund); err != nil {
+		releaseRefund(ctx, refund)
+		return refund, err
+	}
+	if refund.Status == models.RefundStatusCompleted {
+		PublishRefundCompleted(ctx, refund)
+	}
+	return refund, nil
+}
+
+// ApproveRefund records a manager's decision on a refund that is pending
+// approval and publishes refund.completed when it is approved. The approver
+// is the manager managerToken was issued to in the request's tenant; a
+// managerid in the approval must name the same manager.
+func ApproveRefund(ctx context.Context, managerToken string, approval models.RefundApproval) (models.Refund, error) {
+	manager, ok := config.GetManagerTokens()[managerToken]
+	if managerToken == "" || !ok || manager.TenantID != utils.TenantIDFromContext(ctx) {
+		return models.Refund{}, ErrApproverNotAuthenticated
+	}
+	if approval.ManagerID != "" && approval.ManagerID != manager.ID {
+		return models.Refund{}, ErrApproverNotEligible
+	}
+	approval.ManagerID = manager.ID
+
+	refund, err := SelectRefund(ctx, approval.RefundID)
+	if err != nil {
+		return refund, err
+	}
+	if refund.Status != models.RefundStatusPendingApproval {
+		return refund, ErrRefundNotPending
+	}
+	if approval.ManagerID == refund.RequestedBy {
+		return refund, ErrApproverNotEligible
+	}
+
+	refund.ApprovedBy = approval.ManagerID
+	refund.Status = models.RefundStatusRejected
+	if approval.Approved {
+		completedAt := time.Now().UTC()
+		refund.Status = models.RefundStatusCompleted
+		refund.CompletedAt = &completedAt
+	}
+
+	updated, err := repository.UpdateRefund(ctx, refund)
+	if err != nil {
+		return refund, err
+	}
+	if !updated {
+		// Another manager decided on the refund since it was read
+		return refund, ErrRefundNotPending
+	}
+	if refund.Status == models.RefundStatusCompleted {
+		PublishRefundCompleted(ctx, refund)
+	} else {
+		releaseRefund(ctx, refund)
+	}
+	return refund, nil
+}
+
+// SelectRefund returns a refund recorded by the requesting store. Refunds of
+// other stores are reported as not found.
+func SelectRefund(ctx context.Context, refundID string) (models.Refund, error) {
+	refund, err := repository.SelectRefund(ctx, refundID)
+	if err == nil && refund.StoreID != utils.StoreIDFromContext(ctx) {
+		return models.Refund{}, mongo.ErrNoDocuments
+	}
+	return refund, err
+}
+
+// PublishRefundCompleted publishes refund.completed for a stored refund, see
+// publishStateChange.
+func PublishRefundCompleted(ctx context.Context, refund models.Refund) {
+	publishStateChange(ctx, topology.ProductExchange, topology.KeyRefundCompleted, true, refund)
+}
+
+// reserveRefund values refund and adds its quantities to those returned on
+// its receipt. The receipt is saved only if no other refund changed it since
+// it was read, so concurrent refunds cannot together return more than was
+// sold; the refund is checked again when one did.
+func reserveRefund(ctx context.Context, refund *models.Refund) error {
+	priceOf := func(itemCode string) (float64, error) {
+		product, err := SelectProduct(ctx, itemCode)
+		if err == mongo.ErrNoDocuments || errors.Is(err, ErrProductUnavailable) {
+			return 0, fmt.Errorf("%w: unknown itemcode %s", ErrInvalidRefund, itemCode)
+		}
+		return product.Price, err
+	}
+	for attempt := 0; attempt < refundReceiptAttempts; attempt++ {
+		receipt, err := selectRefundReceipt(ctx, refund.StoreID, refund.ReceiptNo)
+		if err != nil {
+			return err
+		}
+		returned, sold := refundReceiptQuantities(receipt)
+		if err := valueRefund(refund, returned, sold, priceOf); err != nil {
+			return err
+		}
+
+		previousVersion := receipt.Version
+		setRefundReceiptQuantities(&receipt, returned, sold)
+		receipt.Version++
+		saved, err := repository.SaveRefundReceipt(ctx, receipt, previousVersion)
+		if err != nil || saved {
+			return err
+		}
+	}
+	return ErrConcurrentRefund
+}
+
+// releaseRefund takes the quantities of a refund that was rejected, or could
+// not be recorded, off those returned on its receipt. When that fails they
+// stay counted as returned, which only keeps them from being refunded again.
+func releaseRefund(ctx context.Context, refund models.Refund) {
+	for attempt := 0; attempt < refundReceiptAttempts; attempt++ {
+		receipt, err := repository.SelectRefundReceipt(ctx, refund.StoreID, refund.ReceiptNo)
+		if err == mongo.ErrNoDocuments {
+			// Receipts are rebuilt from their refunds until first saved
+			return
+		}
+		if err != nil {
+			requestid.Logf(ctx, "Failed to release refund %s: %v", refund.RefundID, err)
+			return
+		}
+		returned, sold := refundReceiptQuantities(receipt)
+		for _, line := range refund.Lines {
+			returned[line.ItemCode] -= line.Quantity
+		}
+
+		previousVersion := receipt.Version
+		setRefundReceiptQuantities(&receipt, returned, sold)
+		receipt.Version++
+		saved, err := repository.SaveRefundReceipt(ctx, receipt, previousVersion)
+		if err != nil {
+			requestid.Logf(ctx, "Failed to release refund %s: %v", refund.RefundID, err)
+			return
+		}
+		if saved {
+			return
+		}
+	}
+	requestid.Logf(ctx, "Failed to release refund %s: %v", refund.RefundID, ErrConcurrentRefund)
+}
+
+// selectRefundReceipt returns the refund receipt of a store's receipt. A
+// receipt that is not stored yet is built from the refunds recorded against
+// it before receipts were, at version 0.
+func selectRefundReceipt(ctx context.Context, storeID, receiptNo string) (models.RefundReceipt, error) {
+	receipt, err := repository.SelectRefundReceipt(ctx, storeID, receiptNo)
+	if err != mongo.ErrNoDocuments {
+		return receipt, err
+	}
+	returned, sold, err := receiptQuantities(ctx, storeID, receiptNo)
+	if err != nil {
+		return receipt, err
+	}
+	receipt = models.RefundReceipt{StoreID: storeID, ReceiptNo: receiptNo}
+	setRefundReceiptQuantities(&receipt, returned, sold)
+	return receipt, nil
+}
+
+// refundReceiptQuantities returns the quantities returned and sold per
+// itemcode on receipt. Items whose sold quantity is not known yet are left
+// out of sold.
+func refundReceiptQuantities(receipt models.RefundReceipt) (returned, sold map[string]int) {
+	returned = make(map[string]int)
+	sold = make(map[string]int)
+	for _, line := range receipt.Lines {
+		returned[line.ItemCode] = line.ReturnedQuantity
+		if line.SoldQuantity > 0 {
+			sold[line.ItemCode] = line.SoldQuantity
+		}
+	}
+	return returned, sold
+}
+
+// setRefundReceiptQuantities replaces the lines of receipt with the returned
+// and sold quantities, ordered by itemcode.
+func setRefundReceiptQuantities(receipt *models.RefundReceipt, returned, sold map[string]int) {
+	lines := make(map[string]*models.RefundReceiptLine)
+	line := func(itemCode string) *models.RefundReceiptLine {
+		if lines[itemCode] == nil {
+			lines[itemCode] = &models.RefundReceiptLine{ItemCode: itemCode}
+		}
+		return lines[itemCode]
+	}
+	for itemCode, quantity := range returned {
+		line(itemCode).ReturnedQuantity = quantity
+	}
+	for itemCode, quantity := range sold {
+		line(itemCode).SoldQuantity = quantity
+	}
+
+	receipt.Lines = make([]models.RefundReceiptLine, 0, len(lines))
+	for _, line := range lines {
+		receipt.Lines = append(receipt.Lines, *line)
+	}
+	sort.Slice(receipt.Lines, func(i, j int) bool { return receipt.Lines[i].ItemCode < receipt.Lines[j].ItemCode })
+}
+
+// valueRefund checks the lines of refund against the quantities returned
+// and sold on its receipt, which it updates, and values them at the price
+// priceOf returns for their itemcode. Lines of an item whose sold quantity
+// the receipt already records take it from there; the first refund of an
+// item records the one it was sent with.
+func valueRefund(refund *models.Refund, returned, sold map[string]int, priceOf func(itemCode string) (float64, error)) error {
+	refund.Total = 0
+	for i := range refund.Lines {
+		line := &refund.Lines[i]
+		if line.Quantity <= 0 {
+			return fmt.Errorf("%w: quantity for %s must be positive", ErrInvalidRefund, line.ItemCode)
+		}
+		if _, ok := models.RefundReasonCodes[line.ReasonCode]; !ok {
+			return fmt.Errorf("%w: unknown reason code %q", ErrInvalidRefund, line.ReasonCode)
+		}
+		if recorded, ok := sold[line.ItemCode]; ok {
+			line.SoldQuantity = recorded
+		} else if line.SoldQuantity <= 0 {
+			return fmt.Errorf("%w: soldquantity for %s is required", ErrInvalidRefund, line.ItemCode)
+		}
+		sold[line.ItemCode] = line.SoldQuantity
+		if returned[line.ItemCode]+line.Quantity > line.SoldQuantity {
+			return fmt.Errorf("%w: %s has %d of %d already returned", ErrInvalidRefund,
+				line.ItemCode, returned[line.ItemCode], line.SoldQuantity)
+		}
+		returned[line.ItemCode] += line.Quantity
+
+		price, err := priceOf(line.ItemCode)
+		if err != nil {
+			return err
+		}
+		line.UnitPrice = price
+		line.Amount = roundAmount(price * float64(line.Quantity))
+		refund.Total += line.Amount
+	}
+	refund.Total = roundAmount(refund.Total)
+	return nil
+}
+
+// receiptQuantities sums the quantities per itemcode already returned
+// against a receipt of a store by refunds that were not rejected, and
+// returns the sold quantities earlier refunds of the receipt recorded.
+func receiptQuantities(ctx context.Context, storeID, receiptNo string) (returned, sold map[string]int, err error) {
+	refunds, err := repository.SelectRefundsByReceipt(ctx, storeID, receiptNo)
+	if err != nil {
+		return nil, nil, err
+	}
+	returned, sold = sumReceiptQuantities(refunds)
+	return returned, sold, nil
+}
+
+// sumReceiptQuantities returns the quantities returned and sold per itemcode
+// by the refunds of one receipt, see receiptQuantities.
+func sumReceiptQuantities(refunds []models.Refund) (returned, sold map[string]int) {
+	returned = make(map[string]int)
+	sold = make(map[string]int)
+	for _, refund := range refunds {
+		for _, line := range refund.Lines {
+			if line.SoldQuantity > 0 {
+				sold[line.ItemCode] = line.SoldQuantity
+			}
+			if refund.Status != models.RefundStatusRejected {
+				returned[line.ItemCode] += line.Quantity
+			}
+		}
+	}
+	return returned, sold
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
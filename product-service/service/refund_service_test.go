@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"reflect"
+	"testing"
+)
+
+func TestValueRefund(t *testing.T) {
+	prices := map[string]float64{"A1": 1.10, "B2": 2.345, "C3": 0.1}
+	priceOf := func(itemCode string) (float64, error) {
+		price, ok := prices[itemCode]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown itemcode %s", ErrInvalidRefund, itemCode)
+		}
+		return price, nil
+	}
+	line := func(itemCode string, quantity, sold int) models.RefundLine {
+		return models.RefundLine{ItemCode: itemCode, Quantity: quantity, SoldQuantity: sold, ReasonCode: "DAMAGED"}
+	}
+
+	tests := []struct {
+		name     string
+		lines    []models.RefundLine
+		returned map[string]int
+		sold     map[string]int
+
+		wantAmounts []float64
+		wantTotal   float64
+		wantSold    []int
+		wantErr     string
+	}{
+		{
+			name:        "valued at current price",
+			lines:       []models.RefundLine{line("A1", 3, 3), line("B2", 2, 5)},
+			wantAmounts: []float64{3.3, 4.69},
+			wantTotal:   7.99,
+		},
+		{
+			name:        "total rounded to cents",
+			lines:       []models.RefundLine{line("C3", 1, 3), line("C3", 2, 3)},
+			wantAmounts: []float64{0.1, 0.2},
+			wantTotal:   0.3,
+		},
+		{
+			name:        "rest of an earlier return",
+			lines:       []models.RefundLine{line("A1", 2, 5)},
+			returned:    map[string]int{"A1": 3},
+			sold:        map[string]int{"A1": 5},
+			wantAmounts: []float64{2.2},
+			wantTotal:   2.2,
+		},
+		{
+			name:     "more than sold",
+			lines:    []models.RefundLine{line("A1", 3, 5)},
+			returned: map[string]int{"A1": 3},
+			sold:     map[string]int{"A1": 5},
+			wantErr:  "invalid refund: A1 has 3 of 5 already returned",
+		},
+		{
+			name:    "lines of one item add up",
+			lines:   []models.RefundLine{line("A1", 2, 3), line("A1", 2, 3)},
+			wantErr: "invalid refund: A1 has 2 of 3 already returned",
+		},
+		{
+			name:        "sold quantity taken from the receipt",
+			lines:       []models.RefundLine{line("A1", 1, 10)},
+			sold:        map[string]int{"A1": 5},
+			wantAmounts: []float64{1.1},
+			wantTotal:   1.1,
+			wantSold:    []int{5},
+		},
+		{
+			name:    "more than the receipt sold",
+			lines:   []models.RefundLine{line("A1", 6, 10)},
+			sold:    map[string]int{"A1": 5},
+			wantErr: "invalid refund: A1 has 0 of 5 already returned",
+		},
+		{
+			name:        "first line records the sold quantity",
+			lines:       []models.RefundLine{line("A1", 1, 5), line("A1", 1, 6)},
+			wantAmounts: []float64{1.1, 1.1},
+			wantTotal:   2.2,
+			wantSold:    []int{5, 5},
+		},
+		{
+			name:    "sold quantity missing",
+			lines:   []models.RefundLine{line("A1", 1, 0)},
+			wantErr: "invalid refund: soldquantity for A1 is required",
+		},
+		{
+			name:        "sold quantity known from the receipt",
+			lines:       []models.RefundLine{line("A1", 1, 0)},
+			sold:        map[string]int{"A1": 5},
+			wantAmounts: []float64{1.1},
+			wantTotal:   1.1,
+			wantSold:    []int{5},
+		},
+		{
+			name:    "quantity not positive",
+			lines:   []models.RefundLine{line("A1", 0, 1)},
+			wantErr: "invalid refund: quantity for A1 must be positive",
+		},
+		{
+			name:    "unknown reason",
+			lines:   []models.RefundLine{{ItemCode: "A1", Quantity: 1, SoldQuantity: 1, ReasonCode: "BORED"}},
+			wantErr: `invalid refund: unknown reason code "BORED"`,
+		},
+		{
+			name:    "unknown item",
+			lines:   []models.RefundLine{line("Z9", 1, 1)},
+			wantErr: "invalid refund: unknown itemcode Z9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returned, sold := map[string]int{}, map[string]int{}
+			for itemCode, quantity := range tt.returned {
+				returned[itemCode] = quantity
+			}
+			for itemCode, quantity := range tt.sold {
+				sold[itemCode] = quantity
+			}
+			refund := models.Refund{Lines: tt.lines, Total: 99}
+
+			err := valueRefund(&refund, returned, sold, priceOf)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr || !errors.Is(err, ErrInvalidRefund) {
+					t.Fatalf("valueRefund = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("valueRefund: %v", err)
+			}
+			var amounts []float64
+			for _, line := range refund.Lines {
+				amounts = append(amounts, line.Amount)
+				if line.UnitPrice != prices[line.ItemCode] {
+					t.Errorf("unit price of %s = %v, want %v", line.ItemCode, line.UnitPrice, prices[line.ItemCode])
+				}
+			}
+			if !reflect.DeepEqual(amounts, tt.wantAmounts) {
+				t.Errorf("amounts = %v, want %v", amounts, tt.wantAmounts)
+			}
+			if refund.Total != tt.wantTotal {
+				t.Errorf("total = %v, want %v", refund.Total, tt.wantTotal)
+			}
+			if tt.wantSold != nil {
+				var sold []int
+				for _, line := range refund.Lines {
+					sold = append(sold, line.SoldQuantity)
+				}
+				if !reflect.DeepEqual(sold, tt.wantSold) {
+					t.Errorf("sold quantities = %v, want %v", sold, tt.wantSold)
+				}
+			}
+		})
+	}
+}
+
+func TestSumReceiptQuantities(t *testing.T) {
+	refunds := []models.Refund{
+		{Status: models.RefundStatusCompleted, Lines: []models.RefundLine{{ItemCode: "A1", Quantity: 1, SoldQuantity: 4}}},
+		{Status: models.RefundStatusPendingApproval, Lines: []models.RefundLine{{ItemCode: "A1", Quantity: 2, SoldQuantity: 4}}},
+		// Rejected refunds return nothing but still record what was sold
+		{Status: models.RefundStatusRejected, Lines: []models.RefundLine{{ItemCode: "B2", Quantity: 3, SoldQuantity: 3}}},
+		// Refunds from before soldquantity was required
+		{Status: models.RefundStatusCompleted, Lines: []models.RefundLine{{ItemCode: "C3", Quantity: 1}}},
+	}
+	returned, sold := sumReceiptQuantities(refunds)
+	if want := map[string]int{"A1": 3, "C3": 1}; !reflect.DeepEqual(returned, want) {
+		t.Errorf("returned = %v, want %v", returned, want)
+	}
+	if want := map[string]int{"A1": 4, "B2": 3}; !reflect.DeepEqual(sold, want) {
+		t.Errorf("sold = %v, want %v", sold, want)
+	}
+}
+
+func TestRefundReceiptQuantities(t *testing.T) {
+	returned := map[string]int{"B2": 2, "A1": 1, "C3": 1}
+	sold := map[string]int{"A1": 4, "B2": 2, "D4": 3}
+
+	var receipt models.RefundReceipt
+	setRefundReceiptQuantities(&receipt, returned, sold)
+	want := []models.RefundReceiptLine{
+		{ItemCode: "A1", SoldQuantity: 4, ReturnedQuantity: 1},
+		{ItemCode: "B2", SoldQuantity: 2, ReturnedQuantity: 2},
+		// Returned before sold quantities were recorded
+		{ItemCode: "C3", ReturnedQuantity: 1},
+		{ItemCode: "D4", SoldQuantity: 3},
+	}
+	if !reflect.DeepEqual(receipt.Lines, want) {
+		t.Errorf("lines = %+v, want %+v", receipt.Lines, want)
+	}
+
+	gotReturned, gotSold := refundReceiptQuantities(receipt)
+	if want := map[string]int{"A1": 1, "B2": 2, "C3": 1, "D4": 0}; !reflect.DeepEqual(gotReturned, want) {
+		t.Errorf("returned = %v, want %v", gotReturned, want)
+	}
+	if !reflect.DeepEqual(gotSold, sold) {
+		t.Errorf("sold = %v, want %v", gotSold, sold)
+	}
+}
+
+func TestApproveRefundNeedsManager(t *testing.T) {
+	// No MANAGER_TOKENS are loaded, so no token authenticates
+	for _, token := range []string{"", "unknown"} {
+		_, err := ApproveRefund(context.Background(), token, models.RefundApproval{RefundID: "r1", Approved: true})
+		if !errors.Is(err, ErrApproverNotAuthenticated) {
+			t.Errorf("ApproveRefund with token %q = %v, want %v", token, err, ErrApproverNotAuthenticated)
+		}
+	}
+}
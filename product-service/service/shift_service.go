@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"product-service/repository"
+	"product-service/utils"
+	"sort"
+	"strings"
+	"time"
+
+	"common/requestid"
+	"common/topology"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidShift     = errors.New("invalid shift")
+	ErrShiftAlreadyOpen = errors.New("terminal already has an open shift")
+	ErrShiftNotOpen     = errors.New("shift is not open")
+	// ErrShiftChanged is returned when takings or cash movements kept being
+	// recorded on a shift while it was closed.
+	ErrShiftChanged = errors.New("shift changed while closing, retry")
+)
+
+// shiftCloseAttempts bounds how often the closing figures are worked out
+// again for a shift that recorded more in the meantime.
+const shiftCloseAttempts = 3
+
+// OpenShift opens a shift on a terminal of the requesting store with the
+// float counted into the drawer. A terminal has at most one open shift.
+func OpenShift(ctx context.Context, shift models.Shift) (models.Shift, error) {
+	shift.StoreID = utils.StoreIDFromContext(ctx)
+	if shift.TerminalID == "" || shift.CashierID == "" {
+		return shift, fmt.Errorf("%w: terminalid and cashierid are required", ErrInvalidShift)
+	}
+	if shift.OpeningFloat < 0 {
+		return shift, fmt.Errorf("%w: opening float must not be negative", ErrInvalidShift)
+	}
+
+	if _, err := repository.SelectOpenShift(ctx, shift.StoreID, shift.TerminalID); err == nil {
+		return shift, ErrShiftAlreadyOpen
+	} else if err != mongo.ErrNoDocuments {
+		return shift, err
+	}
+
+	shift.ShiftID = primitive.NewObjectID().Hex()
+	shift.Status = models.ShiftStatusOpen
+	shift.CashMovements = []models.CashMovement{}
+	shift.Takings = []models.Taking{}
+	shift.ExpectedCash = shift.OpeningFloat
+	shift.CountedCash = nil
+	shift.OverShort = nil
+	shift.OpenedAt = time.Now().UTC()
+	shift.ClosedAt = nil
+
+	if err := repository.InsertShift(ctx, shift); err != nil {
+		return shift, insertShiftError(err)
+	}
+	PublishShiftEvent(ctx, "shift.opened", shift)
+	return shift, nil
+}
+
+// insertShiftError returns the error of storing a new shift. A duplicate key
+// means another shift was opened on the terminal since it was checked.
+func insertShiftError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrShiftAlreadyOpen
+	}
+	return err
+}
+
+// SelectShift returns a shift of the requesting store. Shifts of other
+// stores are reported as not found.
+func SelectShift(ctx context.Context, shiftID string) (models.Shift, error) {
+	shift, err := repository.SelectShift(ctx, shiftID)
+	if err == nil && shift.StoreID != utils.StoreIDFromContext(ctx) {
+		return models.Shift{}, mongo.ErrNoDocuments
+	}
+	return shift, err
+}
+
+// RecordCashMovement records cash put into or taken out of the drawer, for
+// example a change top-up or a safe drop.
+func RecordCashMovement(ctx context.Context, movement models.ShiftCashMovement) (models.Shift, error) {
+	if movement.Type != models.CashMovementIn && movement.Type != models.CashMovementOut {
+		return models.Shift{}, fmt.Errorf("%w: cash movement type must be %q or %q", ErrInvalidShift,
+			models.CashMovementIn, models.CashMovementOut)
+	}
+	if movement.Amount <= 0 {
+		return models.Shift{}, fmt.Errorf("%w: cash movement amount must be positive", ErrInvalidShift)
+	}
+	if _, err := SelectShift(ctx, movement.ShiftID); err != nil {
+		return models.Shift{}, err
+	}
+
+	movement.RecordedAt = time.Now().UTC()
+	shift, err := repository.AppendCashMovement(ctx, movement.ShiftID, movement.CashMovement)
+	if err == mongo.ErrNoDocuments {
+		return shift, ErrShiftNotOpen
+	}
+	if err != nil {
+		return shift, err
+	}
+	PublishShiftEvent(ctx, "shift.cash_"+movement.Type, shift)
+	return shift, nil
+}
+
+// RecordTaking records a payment taken by the till during the shift. Refunds
+// paid out are posted as negative takings.
+func RecordTaking(ctx context.Context, taking models.ShiftTaking) (models.Shift, error) {
+	taking.PaymentMethod = strings.ToLower(strings.TrimSpace(taking.PaymentMethod))
+	if taking.PaymentMethod == "" {
+		return models.Shift{}, fmt.Errorf("%w: paymentmethod is required", ErrInvalidShift)
+	}
+	if taking.Amount == 0 {
+		return models.Shift{}, fmt.Errorf("%w: taking amount must not be zero", ErrInvalidShift)
+	}
+	if _, err := SelectShift(ctx, taking.ShiftID); err != nil {
+		return models.Shift{}, err
+	}
+
+	taking.RecordedAt = time.Now().UTC()
+	shift, err := repository.AppendTaking(ctx, taking.ShiftID, taking.Taking)
+	if err == mongo.ErrNoDocuments {
+		return shift, ErrShiftNotOpen
+	}
+	return shift, err
+}
+
+// CloseShift closes a shift with the cash counted in the drawer and works out
+// how far it is over or short of the expected cash. The shift is only closed
+// with the figures worked out from its latest takings and cash movements.
+func CloseShift(ctx context.Context, shiftClose models.ShiftClose) (models.Shift, error) {
+	if shiftClose.CountedCash < 0 {
+		return models.Shift{}, fmt.Errorf("%w: counted cash must not be negative", ErrInvalidShift)
+	}
+	for attempt := 0; attempt < shiftCloseAttempts; attempt++ {
+		shift, err := SelectShift(ctx, shiftClose.ShiftID)
+		if err != nil {
+			return shift, err
+		}
+		if err := closeShift(&shift, shiftClose.CountedCash, time.Now().UTC()); err != nil {
+			return shift, err
+		}
+		err = repository.CloseShift(ctx, shift)
+		if err == mongo.ErrNoDocuments {
+			// Closed or changed since it was read, look again
+			continue
+		}
+		if err != nil {
+			return shift, err
+		}
+		PublishShiftEvent(ctx, "shift.closed", shift)
+		return shift, nil
+	}
+	return models.Shift{}, ErrShiftChanged
+}
+
+// closeShift sets the closing figures of an open shift for the cash counted
+// at closedAt.
+func closeShift(shift *models.Shift, countedCash float64, closedAt time.Time) error {
+	if shift.Status != models.ShiftStatusOpen {
+		return ErrShiftNotOpen
+	}
+	report := buildShiftReport(*shift)
+	countedCash = roundAmount(countedCash)
+	overShort := roundAmount(countedCash - report.ExpectedCash)
+
+	shift.Status = models.ShiftStatusClosed
+	shift.ExpectedCash = report.ExpectedCash
+	shift.CountedCash = &countedCash
+	shift.OverShort = &overShort
+	shift.ClosedAt = &closedAt
+	return nil
+}
+
+// ShiftReport returns the X report of an open shift or the Z report of a
+// closed one.
+func ShiftReport(ctx context.Context, shiftID string) (models.ShiftReport, error) {
+	shift, err := SelectShift(ctx, shiftID)
+	if err != nil {
+		return models.ShiftReport{}, err
+	}
+	return buildShiftReport(shift), nil
+}
+
+func buildShiftReport(shift models.Shift) models.ShiftReport {
+	report := models.ShiftReport{
+		ReportType:      "X",
+		ShiftID:         shift.ShiftID,
+		StoreID:         shift.StoreID,
+		TerminalID:      shift.TerminalID,
+		CashierID:       shift.CashierID,
+		OpenedAt:        shift.OpenedAt,
+		ClosedAt:        shift.ClosedAt,
+		GeneratedAt:     time.Now().UTC(),
+		OpeningFloat:    shift.OpeningFloat,
+		TakingsByMethod: make(map[string]float64),
+		CountedCash:     shift.CountedCash,
+		OverShort:       shift.OverShort,
+	}
+	if shift.Status == models.ShiftStatusClosed {
+		report.ReportType = "Z"
+	}
+
+	for _, movement := range shift.CashMovements {
+		if movement.Type == models.CashMovementIn {
+			report.CashIn += movement.Amount
+		} else {
+			report.CashOut += movement.Amount
+		}
+	}
+	for _, taking := range shift.Takings {
+		report.TakingsByMethod[taking.PaymentMethod] += taking.Amount
+		report.TotalTakings += taking.Amount
+		report.TransactionCount++
+	}
+	for method, amount := range report.TakingsByMethod {
+		report.TakingsByMethod[method] = roundAmount(amount)
+	}
+
+	report.CashIn = roundAmount(report.CashIn)
+	report.CashOut = roundAmount(report.CashOut)
+	report.TotalTakings = roundAmount(report.TotalTakings)
+	report.ExpectedCash = roundAmount(shift.OpeningFloat + report.CashIn - report.CashOut +
+		report.TakingsByMethod[models.PaymentMethodCash])
+	return report
+}
+
+// FormatShiftReport renders a shift report for a receipt printer.
+func FormatShiftReport(report models.ShiftReport) string {
+	const width = 40
+	var b strings.Builder
+	line := func(label string, amount float64) {
+		value := fmt.Sprintf("%.2f", amount)
+		fmt.Fprintf(&b, "%-*s%s\n", width-len(value), label, value)
+	}
+	rule := strings.Repeat("-", width) + "\n"
+
+	title := report.ReportType + " REPORT"
+	fmt.Fprintf(&b, "%*s\n", (width+len(title))/2, title)
+	b.WriteString(rule)
+	fmt.Fprintf(&b, "Store:    %s\n", report.StoreID)
+	fmt.Fprintf(&b, "Terminal: %s\n", report.TerminalID)
+	fmt.Fprintf(&b, "Cashier:  %s\n", report.CashierID)
+	fmt.Fprintf(&b, "Shift:    %s\n", report.ShiftID)
+	fmt.Fprintf(&b, "Opened:   %s\n", report.OpenedAt.Format("2006-01-02 15:04"))
+	if report.ClosedAt != nil {
+		fmt.Fprintf(&b, "Closed:   %s\n", report.ClosedAt.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(&b, "Printed:  %s\n", report.GeneratedAt.Format("2006-01-02 15:04"))
+	b.WriteString(rule)
+
+	methods := make([]string, 0, len(report.TakingsByMethod))
+	for method := range report.TakingsByMethod {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	b.WriteString("TAKINGS\n")
+	for _, method := range methods {
+		line("  "+strings.ToUpper(method), report.TakingsByMethod[method])
+	}
+	line("Total takings", report.TotalTakings)
+	fmt.Fprintf(&b, "%-*s%d\n", width-len(fmt.Sprint(report.TransactionCount)), "Transactions", report.TransactionCount)
+	b.WriteString(rule)
+
+	b.WriteString("CASH DRAWER\n")
+	line("  Opening float", report.OpeningFloat)
+	line("  Cash takings", report.TakingsByMethod[models.PaymentMethodCash])
+	line("  Cash in", report.CashIn)
+	line("  Cash out", -report.CashOut)
+	line("Expected cash", report.ExpectedCash)
+	if report.CountedCash != nil {
+		line("Counted cash", *report.CountedCash)
+	}
+	if report.OverShort != nil {
+		line("Over/short", *report.OverShort)
+	}
+	b.WriteString(rule)
+	return b.String()
+}
+
+// PublishShiftEvent writes the event of a stored shift change to the logging
+// queue, see publishStateChange.
+func PublishShiftEvent(ctx context.Context, event string, shift models.Shift) {
+	entry := NewLogEntry(models.LogLevelInfo, fmt.Sprintf("Shift %s of terminal %s: %s", shift.ShiftID, shift.TerminalID, event))
+	entry.EventType = event
+	entry.Fields = map[string]interface{}{"shift": shift}
+	entry.CorrelationID = requestid.FromContext(ctx)
+	publishStateChange(ctx, topology.ErrorExchange, topology.LoggingKey(entry.Level), true, entry)
+}
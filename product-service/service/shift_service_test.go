@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"product-service/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var shiftOpenedAt = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+func testShift() models.Shift {
+	return models.Shift{
+		ShiftID:      "sh1",
+		StoreID:      "S1",
+		TerminalID:   "T1",
+		CashierID:    "C1",
+		Status:       models.ShiftStatusOpen,
+		OpeningFloat: 100,
+		CashMovements: []models.CashMovement{
+			{Type: models.CashMovementIn, Amount: 50},
+			{Type: models.CashMovementOut, Amount: 30.25},
+		},
+		Takings: []models.Taking{
+			{PaymentMethod: models.PaymentMethodCash, Amount: 12.5},
+			{PaymentMethod: "card", Amount: 20},
+			// A refund paid out in cash
+			{PaymentMethod: models.PaymentMethodCash, Amount: -2.5},
+			{PaymentMethod: "card", Amount: 5.1},
+		},
+		OpenedAt: shiftOpenedAt,
+	}
+}
+
+func TestBuildShiftReport(t *testing.T) {
+	closed := testShift()
+	closedAt := shiftOpenedAt.Add(8 * time.Hour)
+	closed.Status = models.ShiftStatusClosed
+	closed.ClosedAt = &closedAt
+
+	empty := testShift()
+	empty.CashMovements = nil
+	empty.Takings = nil
+
+	tests := []struct {
+		name  string
+		shift models.Shift
+
+		wantType     string
+		wantCashIn   float64
+		wantCashOut  float64
+		wantByMethod map[string]float64
+		wantTotal    float64
+		wantCount    int
+		wantExpected float64
+	}{
+		{
+			name:         "open shift gives an X report",
+			shift:        testShift(),
+			wantType:     "X",
+			wantCashIn:   50,
+			wantCashOut:  30.25,
+			wantByMethod: map[string]float64{"cash": 10, "card": 25.1},
+			wantTotal:    35.1,
+			wantCount:    4,
+			wantExpected: 129.75,
+		},
+		{
+			name:         "closed shift gives a Z report",
+			shift:        closed,
+			wantType:     "Z",
+			wantCashIn:   50,
+			wantCashOut:  30.25,
+			wantByMethod: map[string]float64{"cash": 10, "card": 25.1},
+			wantTotal:    35.1,
+			wantCount:    4,
+			wantExpected: 129.75,
+		},
+		{
+			name:         "nothing recorded",
+			shift:        empty,
+			wantType:     "X",
+			wantByMethod: map[string]float64{},
+			wantExpected: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := buildShiftReport(tt.shift)
+			if report.ReportType != tt.wantType {
+				t.Errorf("report type = %s, want %s", report.ReportType, tt.wantType)
+			}
+			if report.CashIn != tt.wantCashIn || report.CashOut != tt.wantCashOut {
+				t.Errorf("cash in/out = %v/%v, want %v/%v", report.CashIn, report.CashOut, tt.wantCashIn, tt.wantCashOut)
+			}
+			if !reflect.DeepEqual(report.TakingsByMethod, tt.wantByMethod) {
+				t.Errorf("takings by method = %v, want %v", report.TakingsByMethod, tt.wantByMethod)
+			}
+			if report.TotalTakings != tt.wantTotal || report.TransactionCount != tt.wantCount {
+				t.Errorf("takings = %v in %d, want %v in %d", report.TotalTakings, report.TransactionCount, tt.wantTotal, tt.wantCount)
+			}
+			if report.ExpectedCash != tt.wantExpected {
+				t.Errorf("expected cash = %v, want %v", report.ExpectedCash, tt.wantExpected)
+			}
+		})
+	}
+}
+
+func TestCloseShift(t *testing.T) {
+	closedAt := shiftOpenedAt.Add(8 * time.Hour)
+	tests := []struct {
+		name        string
+		countedCash float64
+		want        float64
+	}{
+		{"exact", 129.75, 0},
+		{"over", 130, 0.25},
+		{"short", 129.7, -0.05},
+		{"counted rounded to cents", 129.754, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shift := testShift()
+			if err := closeShift(&shift, tt.countedCash, closedAt); err != nil {
+				t.Fatalf("closeShift: %v", err)
+			}
+			if shift.Status != models.ShiftStatusClosed || shift.ClosedAt == nil || !shift.ClosedAt.Equal(closedAt) {
+				t.Errorf("shift %s closed at %v, want closed at %v", shift.Status, shift.ClosedAt, closedAt)
+			}
+			if shift.ExpectedCash != 129.75 {
+				t.Errorf("expected cash = %v, want 129.75", shift.ExpectedCash)
+			}
+			if shift.OverShort == nil || *shift.OverShort != tt.want {
+				t.Errorf("over/short = %v, want %v", shift.OverShort, tt.want)
+			}
+		})
+	}
+
+	t.Run("already closed", func(t *testing.T) {
+		shift := testShift()
+		if err := closeShift(&shift, 129.75, closedAt); err != nil {
+			t.Fatalf("closeShift: %v", err)
+		}
+		closed := shift
+		if err := closeShift(&shift, 200, closedAt.Add(time.Hour)); !errors.Is(err, ErrShiftNotOpen) {
+			t.Errorf("closeShift of a closed shift = %v, want %v", err, ErrShiftNotOpen)
+		}
+		if !reflect.DeepEqual(shift, closed) {
+			t.Errorf("closing again changed the shift to %+v", shift)
+		}
+	})
+}
+
+func TestInsertShiftError(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	errUnavailable := errors.New("connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"second open shift on the terminal", duplicate, ErrShiftAlreadyOpen},
+		{"other failure", errUnavailable, errUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := insertShiftError(tt.err); !errors.Is(got, tt.want) {
+				t.Errorf("insertShiftError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatShiftReport(t *testing.T) {
+	shift := testShift()
+	if err := closeShift(&shift, 129.7, shiftOpenedAt.Add(8*time.Hour+30*time.Minute)); err != nil {
+		t.Fatalf("closeShift: %v", err)
+	}
+	report := buildShiftReport(shift)
+	report.GeneratedAt = shiftOpenedAt.Add(9 * time.Hour)
+
+	want := `                Z REPORT
+----------------------------------------
+Store:    S1
+Terminal: T1
+Cashier:  C1
+Shift:    sh1
+Opened:   2024-01-01 08:00
+Closed:   2024-01-01 16:30
+Printed:  2024-01-01 17:00
+----------------------------------------
+TAKINGS
+  CARD                             25.10
+  CASH                             10.00
+Total takings                      35.10
+Transactions                           4
+----------------------------------------
+CASH DRAWER
+  Opening float                   100.00
+  Cash takings                     10.00
+  Cash in                          50.00
+  Cash out                        -30.25
+Expected cash                     129.75
+Counted cash                      129.70
+Over/short                         -0.05
+----------------------------------------
+`
+	if got := FormatShiftReport(report); got != want {
+		t.Errorf("FormatShiftReport =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"product-service/repository"
+	"product-service/utils"
+
+	"common/topology"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidStore       = errors.New("invalid store")
+	ErrProductUnavailable = errors.New("product is not available in this store")
+)
+
+func InsertStore(ctx context.Context, store models.Store) error {
+	if store.StoreID == "" || store.Name == "" {
+		return fmt.Errorf("%w: storeid and name are required", ErrInvalidStore)
+	}
+	if err := repository.InsertStore(ctx, store); err != nil {
+		return err
+	}
+	publishStore(ctx, store)
+	return nil
+}
+
+func UpdateStore(ctx context.Context, store models.Store) error {
+	if store.StoreID == "" || store.Name == "" {
+		return fmt.Errorf("%w: storeid and name are required", ErrInvalidStore)
+	}
+	if err := repository.UpdateStore(ctx, store); err != nil {
+		return err
+	}
+	publishStore(ctx, store)
+	return nil
+}
+
+func SelectStore(ctx context.Context, storeID string) (models.Store, error) {
+	return repository.SelectStore(ctx, storeID)
+}
+
+// UpdateStoreProduct sets the price override and availability of a catalog
+// product in one store.
+func UpdateStoreProduct(ctx context.Context, storeProduct models.StoreProduct) error {
+	if storeProduct.Price != nil && *storeProduct.Price < 0 {
+		return fmt.Errorf("%w: price must not be negative", ErrInvalidStore)
+	}
+	if _, err := repository.SelectStore(ctx, storeProduct.StoreID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("%w: unknown store %s", ErrInvalidStore, storeProduct.StoreID)
+		}
+		return err
+	}
+	product, err := repository.SelectProduct(ctx, storeProduct.ItemCode)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("%w: unknown itemcode %s", ErrInvalidStore, storeProduct.ItemCode)
+		}
+		return err
+	}
+	if err := repository.UpsertStoreProduct(ctx, storeProduct); err != nil {
+		return err
+	}
+	if err := recordCatalogChange(ctx, storeProduct.StoreID, storeProduct.ItemCode); err != nil {
+		return err
+	}
+
+	publishStateChange(utils.WithStoreID(ctx, storeProduct.StoreID), topology.ProductExchange, topology.KeyStoreProductUpdate, true,
+		storeProductEvent{StoreProduct: storeProduct, Category: product.Category})
+	return nil
+}
+
+// storeProductEvent is published for a changed store override. It carries
+// the category of the product for subscribers to catalog changes by
+// category.
+type storeProductEvent struct {
+	models.StoreProduct
+	Category string `json:"category"`
+}
+
+// SelectStoreProduct returns the override for a product in a store. Products
+// without an override are available at the catalog price.
+func SelectStoreProduct(ctx context.Context, storeID, itemCode string) (models.StoreProduct, error) {
+	storeProduct, err := repository.SelectStoreProduct(ctx, storeID, itemCode)
+	if err == mongo.ErrNoDocuments {
+		return models.StoreProduct{StoreID: storeID, ItemCode: itemCode, Available: true}, nil
+	}
+	return storeProduct, err
+}
+
+// applyStoreOverride returns product as it is sold in storeID.
+func applyStoreOverride(ctx context.Context, storeID string, product models.Product) (models.Product, error) {
+	if storeID == "" {
+		return product, nil
+	}
+	storeProduct, err := SelectStoreProduct(ctx, storeID, product.ItemCode)
+	if err != nil {
+		return product, err
+	}
+	if !storeProduct.Available {
+		return product, ErrProductUnavailable
+	}
+	if storeProduct.Price != nil {
+		product.Price = *storeProduct.Price
+	}
+	return product, nil
+}
+
+// publishStore publishes store.upsert for a stored store, see
+// publishStateChange.
+func publishStore(ctx context.Context, store models.Store) {
+	publishStateChange(utils.WithStoreID(ctx, store.StoreID), topology.ProductExchange, topology.KeyStoreUpsert, true, store)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"product-service/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrInvalidSupplier = errors.New("invalid supplier")
+
+func InsertSupplier(ctx context.Context, supplier models.Supplier) error {
+	if supplier.SupplierID == "" || supplier.Name == "" {
+		return fmt.Errorf("%w: supplierid and name are required", ErrInvalidSupplier)
+	}
+	return repository.InsertSupplier(ctx, supplier)
+}
+
+func UpdateSupplier(ctx context.Context, supplier models.Supplier) error {
+	if supplier.SupplierID == "" || supplier.Name == "" {
+		return fmt.Errorf("%w: supplierid and name are required", ErrInvalidSupplier)
+	}
+	return repository.UpdateSupplier(ctx, supplier)
+}
+
+func SelectSupplier(ctx context.Context, supplierID string) (models.Supplier, error) {
+	return repository.SelectSupplier(ctx, supplierID)
+}
+
+// UpdateSupplierProduct links a catalog product to a supplier with the cost
+// price and lead time the supplier quoted for it.
+func UpdateSupplierProduct(ctx context.Context, supplierProduct models.SupplierProduct) error {
+	if supplierProduct.CostPrice < 0 || supplierProduct.LeadTimeDays < 0 {
+		return fmt.Errorf("%w: cost price and lead time must not be negative", ErrInvalidSupplier)
+	}
+	if _, err := repository.SelectSupplier(ctx, supplierProduct.SupplierID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("%w: unknown supplier %s", ErrInvalidSupplier, supplierProduct.SupplierID)
+		}
+		return err
+	}
+	if _, err := repository.SelectProduct(ctx, supplierProduct.ItemCode); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("%w: unknown itemcode %s", ErrInvalidSupplier, supplierProduct.ItemCode)
+		}
+		return err
+	}
+	return repository.UpsertSupplierProduct(ctx, supplierProduct)
+}
+
+func SelectSupplierProducts(ctx context.Context, supplierID string) ([]models.SupplierProduct, error) {
+	return repository.SelectSupplierProducts(ctx, supplierID)
+}
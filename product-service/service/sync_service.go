@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"product-service/repository"
+	"product-service/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"common/requestid"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidSync       = errors.New("invalid sync request")
+	ErrInvalidCheckpoint = errors.New("invalid checkpoint")
+	ErrSyncOpInProgress  = errors.New("operation is being applied by another push")
+)
+
+const (
+	defaultSyncChangeLimit = 500
+	maxSyncChangeLimit     = 1000
+
+	checkpointPrefix = "c1."
+
+	// catalogChangeWriteTimeout keeps a change write well within the grace
+	// its sequence number stays pending for.
+	catalogChangeWriteTimeout = repository.CatalogChangeGrace / 2
+	// syncOpClaimTimeout is how long a push may hold an operation before
+	// another push of it takes over.
+	syncOpClaimTimeout = time.Minute
+)
+
+// encodeCheckpoint turns a catalog change sequence number into the opaque
+// token handed to terminals.
+func encodeCheckpoint(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(checkpointPrefix + strconv.FormatInt(seq, 10)))
+}
+
+func decodeCheckpoint(checkpoint string) (int64, error) {
+	if checkpoint == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(checkpoint)
+	if err != nil {
+		return 0, ErrInvalidCheckpoint
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(string(raw), checkpointPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(string(raw), checkpointPrefix) || seq < 0 {
+		return 0, ErrInvalidCheckpoint
+	}
+	return seq, nil
+}
+
+// recordCatalogChange logs that a product changed in storeID, or in every
+// store when storeID is empty, so terminals pick it up on their next sync.
+func recordCatalogChange(ctx context.Context, storeID, itemCode string) error {
+	seq, err := repository.NextCatalogChangeSeq(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Clear the number even when the request was cancelled meanwhile
+		completeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), catalogChangeWriteTimeout)
+		defer cancel()
+		if err := repository.CompleteCatalogChange(completeCtx, seq); err != nil {
+			requestid.Logf(ctx, "Failed to complete catalog change %d: %v", seq, err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, catalogChangeWriteTimeout)
+	defer cancel()
+	return repository.InsertCatalogChange(ctx, models.CatalogChange{
+		Seq:        seq,
+		StoreID:    storeID,
+		ItemCode:   itemCode,
+		TerminalID: utils.TerminalIDFromContext(ctx),
+		ChangedAt:  time.Now().UTC(),
+	})
+}
+
+func syncItem(product models.Product, storeProduct models.StoreProduct) models.SyncItem {
+	item := models.SyncItem{
+		ItemCode:  product.ItemCode,
+		Name:      product.Name,
+		Price:     product.Price,
+		Category:  product.Category,
+		Jenis:     product.Jenis,
+		Available: storeProduct.Available,
+	}
+	if storeProduct.Price != nil {
+		item.Price = *storeProduct.Price
+	}
+	return item
+}
+
+// currentSyncItem returns a product as it is currently sold in storeID.
+func currentSyncItem(ctx context.Context, storeID, itemCode string) (models.SyncItem, error) {
+	product, err := repository.SelectProduct(ctx, itemCode)
+	if err == mongo.ErrNoDocuments {
+		return models.SyncItem{ItemCode: itemCode, Deleted: true}, nil
+	}
+	if err != nil {
+		return models.SyncItem{}, err
+	}
+	storeProduct, err := SelectStoreProduct(ctx, storeID, itemCode)
+	if err != nil {
+		return models.SyncItem{}, err
+	}
+	return syncItem(product, storeProduct), nil
+}
+
+// SyncSnapshot returns the catalog of the requesting store. The checkpoint
+// is read first, so changes made while the snapshot is read are sent again
+// as changes rather than lost.
+func SyncSnapshot(ctx context.Context) (models.SyncSnapshot, error) {
+	storeID := utils.StoreIDFromContext(ctx)
+	_, seq, err := repository.CatalogChangeHorizon(ctx)
+	if err != nil {
+		return models.SyncSnapshot{}, err
+	}
+
+	products, err := repository.SelectProducts(ctx)
+	if err != nil {
+		return models.SyncSnapshot{}, err
+	}
+	storeProducts, err := repository.SelectStoreProducts(ctx, storeID)
+	if err != nil {
+		return models.SyncSnapshot{}, err
+	}
+	overrides := make(map[string]models.StoreProduct, len(storeProducts))
+	for _, storeProduct := range storeProducts {
+		overrides[storeProduct.ItemCode] = storeProduct
+	}
+
+	snapshot := models.SyncSnapshot{Checkpoint: encodeCheckpoint(seq), Items: make([]models.SyncItem, 0, len(products))}
+	for _, product := range products {
+		storeProduct, ok := overrides[product.ItemCode]
+		if !ok {
+			storeProduct = models.StoreProduct{Available: true}
+		}
+		snapshot.Items = append(snapshot.Items, syncItem(product, storeProduct))
+	}
+	sort.Slice(snapshot.Items, func(i, j int) bool { return snapshot.Items[i].ItemCode < snapshot.Items[j].ItemCode })
+	return snapshot, nil
+}
+
+// SyncChanges returns the items of the requesting store changed after
+// checkpoint, as they are now. Each item is sent once however often it
+// changed. Changes after one still being written are held back, so the
+// returned checkpoint never skips it.
+func SyncChanges(ctx context.Context, checkpoint string, limit int) (models.SyncChanges, error) {
+	storeID := utils.StoreIDFromContext(ctx)
+	afterSeq, err := decodeCheckpoint(checkpoint)
+	if err != nil {
+		return models.SyncChanges{}, err
+	}
+	if limit <= 0 {
+		limit = defaultSyncChangeLimit
+	}
+	if limit > maxSyncChangeLimit {
+		limit = maxSyncChangeLimit
+	}
+
+	currentSeq, visibleSeq, err := repository.CatalogChangeHorizon(ctx)
+	if err != nil {
+		return models.SyncChanges{}, err
+	}
+	if afterSeq > currentSeq {
+		// The checkpoint was not issued by this catalog, for example
+		// after a restore.
+		return models.SyncChanges{Checkpoint: encodeCheckpoint(visibleSeq), Items: []models.SyncItem{}, Resync: true}, nil
+	}
+
+	changes, err := repository.SelectCatalogChanges(ctx, storeID, afterSeq, visibleSeq, int64(limit))
+	if err != nil {
+		return models.SyncChanges{}, err
+	}
+
+	result := models.SyncChanges{Checkpoint: checkpoint, Items: []models.SyncItem{}, HasMore: len(changes) == limit}
+	if checkpoint == "" {
+		result.Checkpoint = encodeCheckpoint(afterSeq)
+	}
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		result.Checkpoint = encodeCheckpoint(change.Seq)
+		if seen[change.ItemCode] {
+			continue
+		}
+		seen[change.ItemCode] = true
+
+		item, err := currentSyncItem(ctx, storeID, change.ItemCode)
+		if err != nil {
+			return models.SyncChanges{}, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
+
+// PushSyncOps applies the operations a terminal queued while offline. They
+// are applied in the order they were recorded, ties broken by OpID, so the
+// outcome does not depend on how the terminal batched them. Catalog edits
+// made against a checkpoint older than a change from somewhere else lose to
+// the server's version. Operations already pushed are answered with their
+// earlier result instead of being applied again.
+func PushSyncOps(ctx context.Context, push models.SyncPush) (models.SyncPushResult, error) {
+	storeID := utils.StoreIDFromContext(ctx)
+	if push.TerminalID == "" {
+		return models.SyncPushResult{}, fmt.Errorf("%w: terminalid is required", ErrInvalidSync)
+	}
+	ctx = utils.WithTerminalID(ctx, push.TerminalID)
+
+	ops := sortSyncOps(push.Ops)
+	result := models.SyncPushResult{Results: make([]models.SyncOpResult, 0, len(ops))}
+	for _, op := range ops {
+		if op.OpID == "" {
+			result.Results = append(result.Results, models.SyncOpResult{
+				Type: op.Type, Status: models.SyncOpStatusRejected, Error: "opid is required",
+			})
+			continue
+		}
+
+		earlier, claimedAt, err := claimSyncOp(ctx, storeID, push.TerminalID, op)
+		if err != nil {
+			return result, err
+		}
+		if earlier != nil {
+			earlier.Duplicate = true
+			result.Results = append(result.Results, *earlier)
+			continue
+		}
+
+		opResult, err := applySyncOp(ctx, op)
+		if err != nil {
+			if releaseErr := repository.ReleaseSyncOp(ctx, storeID, op.OpID, claimedAt); releaseErr != nil {
+				requestid.Logf(ctx, "Failed to release sync operation %s: %v", op.OpID, releaseErr)
+			}
+			return result, err
+		}
+		if err := repository.CompleteSyncOp(ctx, storeID, opResult); err != nil {
+			return result, err
+		}
+		result.Results = append(result.Results, opResult)
+	}
+
+	_, seq, err := repository.CatalogChangeHorizon(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Checkpoint = encodeCheckpoint(seq)
+	return result, nil
+}
+
+// sortSyncOps returns ops in the order they are applied: by when they were
+// recorded, ties broken by OpID.
+func sortSyncOps(ops []models.SyncOp) []models.SyncOp {
+	sorted := append([]models.SyncOp(nil), ops...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+		}
+		return sorted[i].OpID < sorted[j].OpID
+	})
+	return sorted
+}
+
+// claimSyncOp claims op for this push and returns when the claim was
+// recorded. When the operation was pushed before it returns the earlier
+// result instead. A claim left by a push that never finished is taken over
+// once it is older than syncOpClaimTimeout.
+func claimSyncOp(ctx context.Context, storeID, terminalID string, op models.SyncOp) (*models.SyncOpResult, time.Time, error) {
+	for attempt := 0; ; attempt++ {
+		// MongoDB keeps milliseconds, and the claim is released by its time
+		claimedAt := time.Now().UTC().Truncate(time.Millisecond)
+		claimed, err := repository.ClaimSyncOp(ctx, models.SyncOpRecord{
+			StoreID:    storeID,
+			TerminalID: terminalID,
+			Result:     models.SyncOpResult{OpID: op.OpID, Type: op.Type, Status: models.SyncOpStatusPending},
+			RecordedAt: claimedAt,
+		})
+		if err != nil || claimed {
+			return nil, claimedAt, err
+		}
+
+		record, err := repository.SelectSyncOp(ctx, storeID, op.OpID)
+		if err == mongo.ErrNoDocuments && attempt == 0 {
+			// Released since the claim failed
+			continue
+		}
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if record.Result.Status != models.SyncOpStatusPending {
+			return &record.Result, time.Time{}, nil
+		}
+		if attempt > 0 || time.Since(record.RecordedAt) < syncOpClaimTimeout {
+			return nil, time.Time{}, fmt.Errorf("%w: %s", ErrSyncOpInProgress, op.OpID)
+		}
+		if err := repository.ReleaseSyncOp(ctx, storeID, op.OpID, record.RecordedAt); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+}
+
+// applySyncOp applies one operation. Operations the server refuses are
+// reported in the result; only failures worth retrying are returned as
+// errors.
+func applySyncOp(ctx context.Context, op models.SyncOp) (models.SyncOpResult, error) {
+	storeID := utils.StoreIDFromContext(ctx)
+	opResult := models.SyncOpResult{OpID: op.OpID, Type: op.Type, Status: models.SyncOpStatusApplied}
+
+	var applied interface{}
+	var err error
+	switch op.Type {
+	case models.SyncOpProductUpsert:
+		var product models.Product
+		if err = json.Unmarshal(op.Payload, &product); err == nil {
+			if opResult.Item, err = syncConflict(ctx, op, storeID, product.ItemCode); err == nil && opResult.Item == nil {
+				applied, err = upsertProduct(ctx, product)
+			}
+		}
+
+	case models.SyncOpProductDelete:
+		var product models.Product
+		if err = json.Unmarshal(op.Payload, &product); err == nil {
+			if opResult.Item, err = syncConflict(ctx, op, storeID, product.ItemCode); err == nil && opResult.Item == nil {
+				applied, err = deleteProduct(ctx, product.ItemCode)
+			}
+		}
+
+	case models.SyncOpStoreProductUpdate:
+		var storeProduct models.StoreProduct
+		if err = json.Unmarshal(op.Payload, &storeProduct); err == nil {
+			storeProduct.StoreID = storeID
+			if opResult.Item, err = syncConflict(ctx, op, storeID, storeProduct.ItemCode); err == nil && opResult.Item == nil {
+				err = UpdateStoreProduct(ctx, storeProduct)
+				applied = storeProduct
+			}
+		}
+
+	case models.SyncOpShiftTaking:
+		var taking models.ShiftTaking
+		if err = json.Unmarshal(op.Payload, &taking); err == nil {
+			applied, err = RecordTaking(ctx, taking)
+		}
+
+	case models.SyncOpShiftCash:
+		var movement models.ShiftCashMovement
+		if err = json.Unmarshal(op.Payload, &movement); err == nil {
+			applied, err = RecordCashMovement(ctx, movement)
+		}
+
+	case models.SyncOpRefundCreate:
+		var refund models.Refund
+		if err = json.Unmarshal(op.Payload, &refund); err == nil {
+			applied, err = CreateRefund(ctx, refund)
+		}
+
+	default:
+		err = fmt.Errorf("%w: unknown operation type %q", ErrInvalidSync, op.Type)
+	}
+	return syncOpOutcome(opResult, applied, err)
+}
+
+// syncOpOutcome completes the result of an operation from what applying it
+// stored and the error it failed with. A server version set on opResult
+// reports a conflict; rejections win over it.
+func syncOpOutcome(opResult models.SyncOpResult, applied interface{}, err error) (models.SyncOpResult, error) {
+	switch {
+	case err != nil && !isSyncRejection(err):
+		return opResult, err
+	case err != nil:
+		opResult.Status = models.SyncOpStatusRejected
+		opResult.Error = err.Error()
+		opResult.Item = nil
+	case opResult.Item != nil:
+		opResult.Status = models.SyncOpStatusConflict
+		opResult.Error = "product changed on the server since the operation was recorded"
+	case applied != nil:
+		opResult.Result, err = json.Marshal(applied)
+		if err != nil {
+			return opResult, err
+		}
+	}
+	return opResult, nil
+}
+
+// syncConflict returns the server's version of a product when it changed
+// after the operation's base checkpoint through anyone but the pushing
+// terminal, and nil when the operation may be applied.
+func syncConflict(ctx context.Context, op models.SyncOp, storeID, itemCode string) (*models.SyncItem, error) {
+	if itemCode == "" {
+		return nil, fmt.Errorf("%w: itemcode is required", ErrInvalidSync)
+	}
+	baseSeq, err := decodeCheckpoint(op.BaseCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := repository.HasCatalogChangeSince(ctx, storeID, itemCode, baseSeq, utils.TerminalIDFromContext(ctx))
+	if err != nil || !changed {
+		return nil, err
+	}
+	item, err := currentSyncItem(ctx, storeID, itemCode)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func upsertProduct(ctx context.Context, product models.Product) (models.Product, error) {
+	_, err := repository.SelectProduct(ctx, product.ItemCode)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		if err := InsertProduct(ctx, product); err != nil {
+			return product, err
+		}
+		return product, PublishInsertProduct(ctx, product)
+	case err != nil:
+		return product, err
+	}
+	if err := UpdateProduct(ctx, product); err != nil {
+		return product, err
+	}
+	return product, PublishUpdateProduct(ctx, product)
+}
+
+// deleteProduct deletes a product pushed as deleted. A product that is
+// already gone counts as deleted.
+func deleteProduct(ctx context.Context, itemCode string) (interface{}, error) {
+	product, err := DeleteProduct(ctx, itemCode)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return product, PublishDeleteProduct(ctx, product)
+}
+
+// isSyncRejection reports whether err means the operation itself is wrong,
+// so pushing it again would fail the same way.
+func isSyncRejection(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	for _, target := range []error{
+		ErrInvalidSync, ErrInvalidCheckpoint, ErrInvalidStore, ErrInvalidShift,
+		ErrShiftNotOpen, ErrInvalidRefund, mongo.ErrNoDocuments,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
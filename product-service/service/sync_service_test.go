@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"product-service/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCheckpoint(t *testing.T) {
+	for _, seq := range []int64{0, 1, 42, 1 << 40} {
+		checkpoint := encodeCheckpoint(seq)
+		got, err := decodeCheckpoint(checkpoint)
+		if err != nil || got != seq {
+			t.Errorf("decodeCheckpoint(encodeCheckpoint(%d)) = %d, %v", seq, got, err)
+		}
+	}
+
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	tests := []struct {
+		name       string
+		checkpoint string
+		want       int64
+		wantErr    error
+	}{
+		{"empty starts from the beginning", "", 0, nil},
+		{"valid", encode("c1.17"), 17, nil},
+		{"not base64", "c1.17!", 0, ErrInvalidCheckpoint},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("c1.1")), 0, ErrInvalidCheckpoint},
+		{"other version", encode("c2.17"), 0, ErrInvalidCheckpoint},
+		{"no prefix", encode("17"), 0, ErrInvalidCheckpoint},
+		{"not a number", encode("c1.x"), 0, ErrInvalidCheckpoint},
+		{"negative", encode("c1.-1"), 0, ErrInvalidCheckpoint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCheckpoint(tt.checkpoint)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("decodeCheckpoint(%q) = %d, %v, want %d, %v", tt.checkpoint, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSortSyncOps(t *testing.T) {
+	base := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	ops := []models.SyncOp{
+		{OpID: "c", CreatedAt: base.Add(time.Minute)},
+		{OpID: "b", CreatedAt: base},
+		{OpID: "a", CreatedAt: base},
+		{OpID: "d", CreatedAt: base.Add(-time.Minute)},
+	}
+
+	var got []string
+	for _, op := range sortSyncOps(ops) {
+		got = append(got, op.OpID)
+	}
+	if want := []string{"d", "a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %q, want %q", got, want)
+	}
+	if ops[0].OpID != "c" {
+		t.Error("sortSyncOps reordered its argument")
+	}
+}
+
+func TestSyncOpOutcome(t *testing.T) {
+	serverItem := &models.SyncItem{ItemCode: "A1", Price: 12}
+	errUnavailable := errors.New("connection refused")
+	errPayload := json.Unmarshal([]byte(`{"price":"free"}`), &models.Product{})
+	tests := []struct {
+		name    string
+		item    *models.SyncItem
+		applied interface{}
+		err     error
+
+		wantStatus string
+		wantError  string
+		wantItem   *models.SyncItem
+		wantResult string
+		wantErr    error
+	}{
+		{
+			name:       "applied",
+			applied:    models.Product{ItemCode: "A1", Name: "Tea"},
+			wantStatus: models.SyncOpStatusApplied,
+			wantResult: `{"itemcode":"A1","name":"Tea","price":0,"category":"","jenis":""}`,
+		},
+		{
+			name:       "server version wins",
+			item:       serverItem,
+			wantStatus: models.SyncOpStatusConflict,
+			wantError:  "product changed on the server since the operation was recorded",
+			wantItem:   serverItem,
+		},
+		{
+			name:       "rejected",
+			err:        fmt.Errorf("%w: itemcode is required", ErrInvalidSync),
+			wantStatus: models.SyncOpStatusRejected,
+			wantError:  "invalid sync request: itemcode is required",
+		},
+		{
+			name:       "rejection wins over conflict",
+			item:       serverItem,
+			err:        mongo.ErrNoDocuments,
+			wantStatus: models.SyncOpStatusRejected,
+			wantError:  mongo.ErrNoDocuments.Error(),
+		},
+		{
+			name:       "malformed payload rejected",
+			err:        errPayload,
+			wantStatus: models.SyncOpStatusRejected,
+			wantError:  errPayload.Error(),
+		},
+		{
+			name:       "failure retried",
+			err:        errUnavailable,
+			wantStatus: models.SyncOpStatusApplied,
+			wantErr:    errUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opResult := models.SyncOpResult{OpID: "o1", Type: models.SyncOpProductUpsert, Status: models.SyncOpStatusApplied, Item: tt.item}
+			got, err := syncOpOutcome(opResult, tt.applied, tt.err)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("syncOpOutcome error = %v, want %v", err, tt.wantErr)
+			}
+			if got.Status != tt.wantStatus || got.Error != tt.wantError || got.Item != tt.wantItem {
+				t.Errorf("result = %s %q %v, want %s %q %v", got.Status, got.Error, got.Item, tt.wantStatus, tt.wantError, tt.wantItem)
+			}
+			if string(got.Result) != tt.wantResult {
+				t.Errorf("result body = %s, want %s", got.Result, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestSyncConflictChecksOperation(t *testing.T) {
+	// Both are refused before the catalog changes are looked up
+	tests := []struct {
+		name     string
+		op       models.SyncOp
+		itemCode string
+		wantErr  error
+	}{
+		{"no itemcode", models.SyncOp{OpID: "o1"}, "", ErrInvalidSync},
+		{"invalid base checkpoint", models.SyncOp{OpID: "o1", BaseCheckpoint: "???"}, "A1", ErrInvalidCheckpoint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := syncConflict(context.Background(), tt.op, "S1", tt.itemCode)
+			if !errors.Is(err, tt.wantErr) || item != nil {
+				t.Errorf("syncConflict = %v, %v, want %v", item, err, tt.wantErr)
+			}
+			if !isSyncRejection(err) {
+				t.Errorf("%v is not reported as a rejection", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "context"
+
+type contextKey string
+
+const (
+	storeIDKey  contextKey = "storeID"
+	tenantIDKey contextKey = "tenantID"
+
+	terminalIDKey contextKey = "terminalID"
+)
+
+// WithStoreID returns a copy of ctx carrying the store the request was made for.
+func WithStoreID(ctx context.Context, storeID string) context.Context {
+	return context.WithValue(ctx, storeIDKey, storeID)
+}
+
+// StoreIDFromContext returns the store carried by ctx, or "" if there is none.
+func StoreIDFromContext(ctx context.Context) string {
+	storeID, _ := ctx.Value(storeIDKey).(string)
+	return storeID
+}
+
+// WithTenantID returns a copy of ctx carrying the tenant the request belongs to.
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, tenantID)
+}
+
+// TenantIDFromContext returns the tenant carried by ctx, or "" for the
+// default tenant.
+func TenantIDFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantIDKey).(string)
+	return tenantID
+}
+
+// WithTerminalID returns a copy of ctx carrying the terminal whose queued
+// operations are being applied.
+func WithTerminalID(ctx context.Context, terminalID string) context.Context {
+	return context.WithValue(ctx, terminalIDKey, terminalID)
+}
+
+// TerminalIDFromContext returns the terminal carried by ctx, or "" when the
+// change is not made on behalf of a terminal.
+func TerminalIDFromContext(ctx context.Context) string {
+	terminalID, _ := ctx.Value(terminalIDKey).(string)
+	return terminalID
+}
@@ -15,3 +15,9 @@ func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
     w.WriteHeader(code)
     w.Write(response)
 }
+
+func RespondWithText(w http.ResponseWriter, code int, text string) {
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    w.WriteHeader(code)
+    w.Write([]byte(text))
+}
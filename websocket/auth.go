@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"websocket/config"
+	"websocket/protocol"
+)
+
+var (
+	errMissingToken  = errors.New("missing terminal token")
+	errInvalidToken  = errors.New("invalid terminal token")
+	errIdentityClash = errors.New("token does not belong to the requested tenant or store")
+)
+
+// terminalIdentity is the terminal and store a token was issued to.
+type terminalIdentity struct {
+	terminalID string
+	storeID    string
+	tenantID   string
+}
+
+// loadTerminalTokens reads WS_TERMINAL_TOKENS, a comma separated list of
+// token:terminal:store[:tenant] entries.
+func loadTerminalTokens() map[string]terminalIdentity {
+	tokens := make(map[string]terminalIdentity)
+	for _, entry := range strings.Split(config.GetTerminalTokens(), ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) < 3 || len(fields) > 4 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+			if strings.TrimSpace(entry) != "" {
+				log.Println("Ignoring malformed WS_TERMINAL_TOKENS entry")
+			}
+			continue
+		}
+		identity := terminalIdentity{terminalID: fields[1], storeID: fields[2]}
+		if len(fields) == 4 {
+			identity.tenantID = fields[3]
+		}
+		tokens[fields[0]] = identity
+	}
+	return tokens
+}
+
+// loadAllowedOrigins reads WS_ALLOWED_ORIGINS, a comma separated list of
+// origins such as https://pos.example.com. A "*" entry allows any origin.
+func loadAllowedOrigins() map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(config.GetAllowedOrigins(), ",") {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		if origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
+
+// authenticator checks WebSocket handshakes against the origin allowlist
+// and the terminal tokens.
+type authenticator struct {
+	origins map[string]bool
+	tokens  map[string]terminalIdentity
+}
+
+func newAuthenticator() *authenticator {
+	return &authenticator{origins: loadAllowedOrigins(), tokens: loadTerminalTokens()}
+}
+
+// checkOrigin allows handshakes from the configured origins. Without an
+// allowlist only pages served by this host may connect. Requests without an
+// Origin header do not come from a browser and are left to the token check.
+func (a *authenticator) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(a.origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return a.origins["*"] || a.origins[strings.TrimSuffix(strings.ToLower(origin), "/")]
+}
+
+// handshakeToken returns the token sent as the token query parameter or,
+// for browsers, as a token.<token> entry of Sec-WebSocket-Protocol.
+func handshakeToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	for _, subprotocol := range websocketSubprotocols(r) {
+		if token, ok := strings.CutPrefix(subprotocol, protocol.TokenSubprotocolPrefix); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+func websocketSubprotocols(r *http.Request) []string {
+	var subprotocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, subprotocol := range strings.Split(header, ",") {
+			if subprotocol = strings.TrimSpace(subprotocol); subprotocol != "" {
+				subprotocols = append(subprotocols, subprotocol)
+			}
+		}
+	}
+	return subprotocols
+}
+
+// authenticate resolves the session of a handshake. The terminal, tenant
+// and store come from the token, and a tenant or store requested on the
+// handshake must match it.
+func (a *authenticator) authenticate(r *http.Request) (session, error) {
+	s := session{tenantID: resolveTenant(r), storeID: resolveStore(r)}
+	token := handshakeToken(r)
+	if token == "" {
+		return session{}, errMissingToken
+	}
+	identity, ok := a.tokens[token]
+	if !ok {
+		return session{}, errInvalidToken
+	}
+	if (s.tenantID != "" && s.tenantID != identity.tenantID) || (s.storeID != "" && s.storeID != identity.storeID) {
+		return session{}, errIdentityClash
+	}
+	return session{terminalID: identity.terminalID, tenantID: identity.tenantID, storeID: identity.storeID}, nil
+}
+
+// authorize checks that the connection may send env. Catalog changes and
+// sync go to product-service's store routes, so they need a connection bound
+// to a store. Authenticated terminals may only push their own operations.
+func authorize(s session, env protocol.Envelope) *protocol.Error {
+	if push, ok := env.Payload.(*protocol.SyncPush); ok && s.terminalID != "" && push.TerminalID != "" && push.TerminalID != s.terminalID {
+		return &protocol.Error{Code: protocol.CodeForbidden, Message: "Operations of another terminal cannot be pushed"}
+	}
+
+	switch env.Type {
+	case protocol.TypeProductInsert, protocol.TypeProductUpdate,
+		protocol.TypeSyncSnapshot, protocol.TypeSyncChanges, protocol.TypeSyncPush:
+		if s.storeID == "" {
+			return &protocol.Error{Code: protocol.CodeForbidden, Message: "Connection is not bound to a store"}
+		}
+	}
+	return nil
+}
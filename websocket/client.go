@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds every write, so a stuck terminal cannot block its
+	// writer forever.
+	writeWait = 10 * time.Second
+
+	// pongWait is how long a client may stay silent before it is dropped.
+	// Pings are sent often enough for a live client to answer in time.
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+
+	maxMessageSize = 64 * 1024
+)
+
+// client is one WebSocket connection. All writes go through its bounded send
+// queue and are performed by writePump, the only goroutine writing to conn.
+type client struct {
+	hub  *hub
+	conn *websocket.Conn
+	session
+
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newClient(h *hub, conn *websocket.Conn, s session) *client {
+	return &client{
+		hub:     h,
+		conn:    conn,
+		session: s,
+		send:    make(chan []byte, h.queueLen),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue queues v for delivery without blocking. When the queue is full
+// the message is dropped or the client disconnected, depending on the hub's
+// slow client policy.
+func (c *client) enqueue(v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Println("JSON marshal:", err)
+		return
+	}
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	select {
+	case c.send <- message:
+	default:
+		if c.hub.policy == slowClientDrop {
+			c.hub.messagesDropped.Add(1)
+			return
+		}
+		c.hub.slowDisconnects.Add(1)
+		log.Printf("Disconnecting slow client of tenant %q store %q", c.tenantID, c.storeID)
+		c.close()
+	}
+}
+
+// enqueueWait queues v for delivery, waiting for room in the queue instead
+// of applying the slow client policy. A closed client is skipped.
+func (c *client) enqueueWait(v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Println("JSON marshal:", err)
+		return
+	}
+
+	select {
+	case c.send <- message:
+	case <-c.done:
+	}
+}
+
+// queueRoom returns how many more messages fit in the send queue.
+func (c *client) queueRoom() int {
+	return cap(c.send) - len(c.send)
+}
+
+// close asks writePump to send a close frame and shut the connection.
+func (c *client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// writePump delivers queued messages and pings the client until the client
+// is closed or a write fails.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Println("Write:", err)
+				c.close()
+				return
+			}
+			c.hub.messagesSent.Add(1)
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Println("Ping:", err)
+				c.close()
+				return
+			}
+
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeWait))
+			return
+		}
+	}
+}
+
+// readPump reads messages from the client and hands them to handle until
+// the connection fails or the client stops answering pings.
+func (c *client) readPump(handle func(message []byte)) {
+	defer c.close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.hub.heartbeatTimeouts.Add(1)
+				log.Printf("Client of tenant %q store %q stopped answering pings", c.tenantID, c.storeID)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Read:", err)
+			}
+			return
+		}
+		handle(message)
+	}
+}
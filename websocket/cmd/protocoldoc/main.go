@@ -0,0 +1,151 @@
+// Command protocoldoc writes the WebSocket protocol document from the types
+// of package protocol. Run it through go generate after changing them.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"websocket/protocol"
+)
+
+func main() {
+	output := flag.String("o", "PROTOCOL.md", "file to write the document to, - for stdout")
+	flag.Parse()
+
+	var doc bytes.Buffer
+	writeDoc(&doc)
+
+	if *output == "-" {
+		os.Stdout.Write(doc.Bytes())
+		return
+	}
+	if err := os.WriteFile(*output, doc.Bytes(), 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+}
+
+func writeDoc(w *bytes.Buffer) {
+	fmt.Fprintln(w, "# WebSocket protocol")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "<!-- Generated by cmd/protocoldoc from package protocol. DO NOT EDIT. -->")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Protocol version: %d\n\n", protocol.Version)
+	fmt.Fprintln(w, "Terminals connect to `/ws`. Every frame, in both directions, is a JSON")
+	fmt.Fprintln(w, "envelope whose `payload` depends on its `type`. Frames sent by clients are")
+	fmt.Fprintln(w, "validated against the schemas below; a frame that fails validation is")
+	fmt.Fprintln(w, "answered by an `error` message carrying the request `id`, when it could be read.")
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "## Handshake")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "The handshake must carry the terminal's token, either as the `token` query")
+	fmt.Fprintf(w, "parameter or, from browsers, in `Sec-WebSocket-Protocol: %s, %s<token>`.\n", protocol.Subprotocol, protocol.TokenSubprotocolPrefix)
+	fmt.Fprintln(w, "The connection then acts for the terminal, store and tenant the token was")
+	fmt.Fprintln(w, "issued to; handshakes without a valid token are refused. Browser handshakes")
+	fmt.Fprintln(w, "are also checked against the allowed origins.")
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "## Envelope")
+	fmt.Fprintln(w)
+	writeFields(w, protocol.SchemaOf(protocol.Envelope{}))
+
+	fmt.Fprintln(w, "## Messages")
+	fmt.Fprintln(w)
+	for _, direction := range []protocol.Direction{protocol.ClientToServer, protocol.ServerToClient} {
+		if direction == protocol.ClientToServer {
+			fmt.Fprintln(w, "### Client to server")
+		} else {
+			fmt.Fprintln(w, "### Server to client")
+		}
+		fmt.Fprintln(w)
+		for _, m := range protocol.Messages {
+			if m.Direction != direction {
+				continue
+			}
+			fmt.Fprintf(w, "#### `%s`\n\n%s\n\n", m.Type, m.Description)
+			schema := protocol.SchemaOf(m.Payload)
+			writeFields(w, schema)
+			writeSchema(w, schema)
+		}
+	}
+
+	fmt.Fprintln(w, "## Error codes")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Code | Meaning |")
+	fmt.Fprintln(w, "| --- | --- |")
+	for _, code := range protocol.ErrorCodes {
+		fmt.Fprintf(w, "| `%s` | %s |\n", code.Code, code.Description)
+	}
+}
+
+// writeFields writes the properties of an object schema as a table.
+func writeFields(w *bytes.Buffer, schema protocol.Schema) {
+	properties, _ := schema["properties"].(protocol.Schema)
+	if len(properties) == 0 {
+		fmt.Fprintln(w, "No payload fields.")
+		fmt.Fprintln(w)
+		return
+	}
+
+	required := map[string]bool{}
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			required[name.(string)] = true
+		}
+	}
+
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "| Field | Type | Required | Description |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+	for _, name := range names {
+		property := properties[name].(protocol.Schema)
+		description, _ := property["description"].(string)
+		requiredText := "no"
+		if required[name] {
+			requiredText = "yes"
+		}
+		fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", name, typeName(property), requiredText, description)
+	}
+	fmt.Fprintln(w)
+}
+
+func typeName(schema protocol.Schema) string {
+	name, ok := schema["type"].(string)
+	if !ok {
+		return "any"
+	}
+	if format, ok := schema["format"].(string); ok {
+		return name + " (" + format + ")"
+	}
+	if items, ok := schema["items"].(protocol.Schema); ok {
+		return "array of " + typeName(items)
+	}
+	return name
+}
+
+func writeSchema(w *bytes.Buffer, schema protocol.Schema) {
+	body, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode schema: %v", err)
+	}
+	fmt.Fprintln(w, "<details><summary>JSON schema</summary>")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "```json")
+	fmt.Fprintln(w, strings.TrimSpace(string(body)))
+	fmt.Fprintln(w, "```")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "</details>")
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"websocket/protocol"
+)
+
+// feedHistorySize is how many catalog changes are kept so reconnecting
+// terminals can resume from the last sequence number they saw.
+const feedHistorySize = 1000
+
+// productEvent is a catalog change pushed to subscribed clients as a
+// message of type Type. Master product changes carry the overrides of the
+// stores that sell the product differently, by store ID.
+type productEvent struct {
+	protocol.ProductEvent
+	Type      string
+	tenantID  string
+	overrides map[string]storeOverride
+}
+
+// storeOverride is the price and availability of a product in one store.
+// A nil Price keeps the catalog price.
+type storeOverride struct {
+	StoreID   string   `json:"storeid"`
+	Price     *float64 `json:"price"`
+	Available bool     `json:"available"`
+}
+
+// forStore returns event as a subscriber of storeID gets it: master product
+// changes carry the store's price, and are left out in stores that do not
+// sell the product.
+func (event productEvent) forStore(storeID string) (productEvent, bool) {
+	if event.Type != protocol.TypeProductCreated && event.Type != protocol.TypeProductUpdated {
+		return event, true
+	}
+	override, ok := event.overrides[storeID]
+	if !ok || override.Price == nil {
+		return event, !ok || override.Available
+	}
+	if !override.Available {
+		return event, false
+	}
+
+	var product map[string]json.RawMessage
+	if err := json.Unmarshal(event.Product, &product); err != nil {
+		return event, true
+	}
+	product["price"], _ = json.Marshal(*override.Price)
+	if body, err := json.Marshal(product); err == nil {
+		event.Product = body
+	}
+	return event, true
+}
+
+// subscription filters the changes a client receives. Empty filters match
+// every product.
+type subscription struct {
+	Categories []string
+	ItemCodes  []string
+}
+
+func (s subscription) matches(event productEvent) bool {
+	if len(s.Categories) == 0 && len(s.ItemCodes) == 0 {
+		return true
+	}
+	for _, category := range s.Categories {
+		if category == event.Category {
+			return true
+		}
+	}
+	for _, itemCode := range s.ItemCodes {
+		if itemCode == event.ItemCode {
+			return true
+		}
+	}
+	return false
+}
+
+type feedSubscriber struct {
+	tenantID string
+	storeID  string
+	filter   subscription
+	// send delivers a change without blocking, replay waits for room in
+	// the client's send queue, which room reports.
+	send   func(productEvent)
+	replay func(productEvent)
+	room   func() int
+
+	mu sync.Mutex
+	// backlog holds the changes to replay, and the ones published while
+	// they are, so they reach the client in order.
+	backlog   []productEvent
+	replaying bool
+}
+
+// wants reports whether event goes to sub: it has to be of the same tenant,
+// of sub's store when it is a store product change, and match the filter.
+func (sub *feedSubscriber) wants(event productEvent) bool {
+	if sub.tenantID != event.tenantID {
+		return false
+	}
+	if event.Type == protocol.TypeStoreProductUpdated && event.StoreID != sub.storeID {
+		return false
+	}
+	return sub.filter.matches(event)
+}
+
+// eventFor returns event as sub gets it, adjusted to sub's store, and
+// whether sub gets it at all.
+func (sub *feedSubscriber) eventFor(event productEvent) (productEvent, bool) {
+	if !sub.wants(event) {
+		return event, false
+	}
+	return event.forStore(sub.storeID)
+}
+
+// deliver sends event, or holds it back until the replay is done.
+func (sub *feedSubscriber) deliver(event productEvent) {
+	sub.mu.Lock()
+	if sub.replaying {
+		sub.backlog = append(sub.backlog, event)
+		sub.mu.Unlock()
+		return
+	}
+	sub.mu.Unlock()
+	sub.send(event)
+}
+
+// catchUp replays the changes missed before subscribing and those published
+// meanwhile, then lets new changes through. It blocks while the client's
+// send queue is full.
+func (sub *feedSubscriber) catchUp() {
+	for {
+		sub.mu.Lock()
+		backlog := sub.backlog
+		sub.backlog = nil
+		if len(backlog) == 0 {
+			sub.replaying = false
+			sub.mu.Unlock()
+			return
+		}
+		sub.mu.Unlock()
+
+		for _, event := range backlog {
+			sub.replay(event)
+		}
+	}
+}
+
+// feed keeps the recent catalog changes and delivers new ones to the
+// subscribers of the same tenant. The changes are read from the
+// product_events stream, numbered by their offset in it, so every instance
+// numbers them the same and rebuilds its history from the stream on start.
+type feed struct {
+	mu          sync.Mutex
+	seq         uint64
+	history     []productEvent
+	subscribers map[*client]*feedSubscriber
+	// started is when the feed began reading the stream. Changes published
+	// before it are only kept for resuming, not delivered.
+	started time.Time
+}
+
+func newFeed() *feed {
+	return &feed{subscribers: make(map[*client]*feedSubscriber), started: time.Now()}
+}
+
+// publish keeps event and delivers it to every matching subscriber unless it
+// was published before the feed started. Events up to the latest seq were
+// already read, before the stream was consumed again after a reconnect, and
+// are skipped.
+func (f *feed) publish(event productEvent, publishedAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if event.Seq <= f.seq {
+		return
+	}
+	f.seq = event.Seq
+	f.history = append(f.history, event)
+	if len(f.history) > feedHistorySize {
+		f.history = f.history[len(f.history)-feedHistorySize:]
+	}
+
+	if !publishedAt.IsZero() && publishedAt.Before(f.started) {
+		return
+	}
+	for _, sub := range f.subscribers {
+		if event, ok := sub.eventFor(event); ok {
+			sub.deliver(event)
+		}
+	}
+}
+
+// subscribe registers c for the changes matching filter, replacing any
+// earlier subscription of c. With resumeFrom set, the changes after that
+// sequence number are queued for sub.catchUp, which the caller runs before
+// acknowledging. It reports false when they are no longer all kept, or do
+// not fit in the client's send queue, and the client has to reload the
+// catalog instead.
+func (f *feed) subscribe(c *client, sub *feedSubscriber, resumeFrom uint64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subscribers[c] = sub
+	if resumeFrom == 0 {
+		return true
+	}
+	if resumeFrom > f.seq {
+		// The client saw changes this instance has not read from the
+		// stream yet.
+		return false
+	}
+	if len(f.history) > 0 && resumeFrom < f.history[0].Seq-1 {
+		return false
+	}
+	var missed []productEvent
+	for _, event := range f.history {
+		if event.Seq <= resumeFrom {
+			continue
+		}
+		if event, ok := sub.eventFor(event); ok {
+			missed = append(missed, event)
+		}
+	}
+	if len(missed) > sub.room() {
+		return false
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.backlog = missed
+	sub.replaying = len(missed) > 0
+	return true
+}
+
+func (f *feed) unsubscribe(c *client) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subscribers, c)
+}
+
+// lastSeq returns the sequence number of the latest change.
+func (f *feed) lastSeq() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seq
+}
+
+func (f *feed) subscriberCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/codes"
+
+	"common/rabbitmq"
+	"common/topology"
+	"common/tracing"
+	"websocket/config"
+	"websocket/protocol"
+)
+
+// productEventTypes maps the routing keys product-service publishes catalog
+// changes with to the notification types sent to clients.
+var productEventTypes = map[string]string{
+	topology.KeyProductInsert: protocol.TypeProductCreated,
+	topology.KeyProductUpdate: protocol.TypeProductUpdated,
+	topology.KeyProductDelete: protocol.TypeProductDeleted,
+
+	topology.KeyStoreProductUpdate: protocol.TypeStoreProductUpdated,
+}
+
+// feedPrefetch is how many stream entries the broker sends ahead of their
+// acknowledgement.
+const feedPrefetch = 100
+
+// consumeProductEvents feeds the catalog changes kept in the
+// product_events_stream into f, reading the stream from its first entry so
+// the history and sequence numbers survive a restart. After a reconnect the
+// stream is read from the start again and f skips the changes it has seen.
+// The returned manager is stopped on shutdown.
+func consumeProductEvents(f *feed) (*rabbitmq.Manager, error) {
+	rabbitMQ, err := rabbitmq.Dial(config.GetRabbitMQURL())
+	if err != nil {
+		return nil, err
+	}
+
+	// The shared topology declares the stream and binds it to
+	// product_events
+	err = rabbitMQ.OnConnect(topology.Default.Declare)
+	if err != nil {
+		rabbitMQ.Close()
+		return nil, err
+	}
+	// Stream consumers need a prefetch limit
+	err = rabbitMQ.OnConnect(func(ch *amqp091.Channel) error {
+		return ch.Qos(feedPrefetch, 0, false)
+	})
+	if err != nil {
+		rabbitMQ.Close()
+		return nil, err
+	}
+
+	err = rabbitMQ.Consume(rabbitmq.Consumer{
+		Queue: topology.ProductEventsStream,
+		Args:  amqp091.Table{"x-stream-offset": "first"},
+		Handle: func(d amqp091.Delivery) {
+			handleProductEvent(f, d)
+			d.Ack(false)
+		},
+	})
+	if err != nil {
+		rabbitMQ.Close()
+		return nil, err
+	}
+	checker.AddReadiness("rabbitmq", rabbitMQ.Check)
+	checker.AddReadiness("consumer:"+topology.ProductEventsStream, rabbitMQ.ConsumerCheck(topology.ProductEventsStream))
+	return rabbitMQ, nil
+}
+
+// handleProductEvent publishes a catalog change to the feed subscribers.
+func handleProductEvent(f *feed, d amqp091.Delivery) {
+	eventType, ok := productEventTypes[d.RoutingKey]
+	if !ok {
+		return
+	}
+	// Offsets start at 0, which subscribers use for not resuming
+	offset, ok := d.Headers["x-stream-offset"].(int64)
+	if !ok {
+		log.Printf("Product event %s has no stream offset", d.RoutingKey)
+		return
+	}
+	_, span := tracing.StartConsume(d, topology.ProductEvents)
+	defer span.End()
+
+	var product struct {
+		ItemCode string `json:"itemcode"`
+		Category string `json:"category"`
+		StoreID  string `json:"storeid"`
+	}
+	if err := json.Unmarshal(d.Body, &product); err != nil {
+		log.Printf("Failed to decode product event %s: %v", d.RoutingKey, err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	var overrides []storeOverride
+	if header, ok := d.Headers["x-store-overrides"].(string); ok {
+		if err := json.Unmarshal([]byte(header), &overrides); err != nil {
+			log.Printf("Failed to decode store overrides of product event %s: %v", d.RoutingKey, err)
+		}
+	}
+
+	tenantID, _ := d.Headers["x-tenant-id"].(string)
+	storeID, _ := d.Headers["x-store-id"].(string)
+	if product.StoreID != "" {
+		storeID = product.StoreID
+	}
+	publishedAt := d.Timestamp.UTC()
+	if d.Timestamp.IsZero() {
+		publishedAt = time.Now().UTC()
+	}
+	event := productEvent{
+		Type: eventType,
+		ProductEvent: protocol.ProductEvent{
+			Seq:      uint64(offset) + 1,
+			StoreID:  storeID,
+			ItemCode: product.ItemCode,
+			Category: product.Category,
+			Product:  json.RawMessage(d.Body),
+			Time:     publishedAt,
+		},
+		tenantID:  tenantID,
+		overrides: make(map[string]storeOverride, len(overrides)),
+	}
+	for _, override := range overrides {
+		event.overrides[override.StoreID] = override
+	}
+	f.publish(event, d.Timestamp)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+
+	"common/topology"
+	"websocket/protocol"
+)
+
+func TestFeedPublish(t *testing.T) {
+	f := newFeed()
+	var got []uint64
+	f.subscribe(&client{}, &feedSubscriber{tenantID: "a", send: func(event productEvent) {
+		got = append(got, event.Seq)
+	}}, 0)
+
+	before, after := f.started.Add(-time.Minute), f.started.Add(time.Second)
+	event := func(seq uint64) productEvent {
+		return productEvent{Type: protocol.TypeProductUpdated, ProductEvent: protocol.ProductEvent{Seq: seq, ItemCode: "A1"}, tenantID: "a"}
+	}
+	// The stream is read from its start: older changes are only kept, and
+	// the ones read again after a reconnect are skipped
+	f.publish(event(1), before)
+	f.publish(event(2), before)
+	f.publish(event(3), after)
+	f.publish(event(2), before)
+	f.publish(event(3), after)
+	f.publish(event(4), time.Time{})
+
+	if want := []uint64{3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if f.lastSeq() != 4 || len(f.history) != 4 {
+		t.Errorf("seq %d with %d kept, want 4 with 4", f.lastSeq(), len(f.history))
+	}
+}
+
+func TestFeedResume(t *testing.T) {
+	f := newFeed()
+	for seq := uint64(11); seq <= 15; seq++ {
+		f.publish(productEvent{
+			Type:         protocol.TypeProductUpdated,
+			ProductEvent: protocol.ProductEvent{Seq: seq, StoreID: "S1", ItemCode: "A1"},
+			tenantID:     "a",
+		}, time.Time{})
+	}
+	f.publish(productEvent{
+		Type:         protocol.TypeStoreProductUpdated,
+		ProductEvent: protocol.ProductEvent{Seq: 16, StoreID: "S2", ItemCode: "A1"},
+		tenantID:     "a",
+	}, time.Time{})
+	f.publish(productEvent{
+		Type:         protocol.TypeProductUpdated,
+		ProductEvent: protocol.ProductEvent{Seq: 17, ItemCode: "A1"},
+		tenantID:     "b",
+	}, time.Time{})
+
+	tests := []struct {
+		name       string
+		resumeFrom uint64
+		wantOK     bool
+		want       []uint64
+	}{
+		{"not resuming", 0, true, nil},
+		{"up to date", 17, true, nil},
+		{"missed some", 13, true, []uint64{14, 15}},
+		{"oldest kept", 10, true, []uint64{11, 12, 13, 14, 15}},
+		{"older than kept", 9, false, nil},
+		{"ahead of this instance", 18, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint64
+			record := func(event productEvent) { got = append(got, event.Seq) }
+			sub := &feedSubscriber{tenantID: "a", storeID: "S1", send: record, replay: record, room: func() int { return 256 }}
+			if ok := f.subscribe(&client{}, sub, tt.resumeFrom); ok != tt.wantOK {
+				t.Errorf("subscribe = %v, want %v", ok, tt.wantOK)
+			}
+			sub.catchUp()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedResumeQueueRoom(t *testing.T) {
+	f := newFeed()
+	for seq := uint64(1); seq <= 10; seq++ {
+		f.publish(productEvent{Type: protocol.TypeProductUpdated, ProductEvent: protocol.ProductEvent{Seq: seq}, tenantID: "a"}, time.Time{})
+	}
+
+	tests := []struct {
+		name       string
+		resumeFrom uint64
+		queued     int
+		wantOK     bool
+		want       []uint64
+	}{
+		{"backlog fits", 6, 0, true, []uint64{7, 8, 9, 10}},
+		{"backlog larger than the queue", 5, 0, false, nil},
+		{"backlog larger than the room left", 8, 3, false, nil},
+		{"full queue", 9, 4, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &client{send: make(chan []byte, 4)}
+			for i := 0; i < tt.queued; i++ {
+				c.send <- nil
+			}
+			var got []uint64
+			sub := &feedSubscriber{
+				tenantID: "a",
+				send:     func(event productEvent) { t.Errorf("sent %d without waiting for room", event.Seq) },
+				replay:   func(event productEvent) { got = append(got, event.Seq) },
+				room:     c.queueRoom,
+			}
+			if ok := f.subscribe(c, sub, tt.resumeFrom); ok != tt.wantOK {
+				t.Errorf("subscribe = %v, want %v", ok, tt.wantOK)
+			}
+			sub.catchUp()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedResumeKeepsOrder(t *testing.T) {
+	f := newFeed()
+	event := func(seq uint64) productEvent {
+		return productEvent{Type: protocol.TypeProductUpdated, ProductEvent: protocol.ProductEvent{Seq: seq}, tenantID: "a"}
+	}
+	for seq := uint64(1); seq <= 3; seq++ {
+		f.publish(event(seq), time.Time{})
+	}
+
+	// Changes published while the missed ones are replayed wait for them
+	var got []uint64
+	published := false
+	record := func(event productEvent) { got = append(got, event.Seq) }
+	sub := &feedSubscriber{tenantID: "a", send: record, room: func() int { return 8 }}
+	sub.replay = func(e productEvent) {
+		record(e)
+		if !published {
+			published = true
+			f.publish(event(4), time.Time{})
+		}
+	}
+	if !f.subscribe(&client{}, sub, 1) {
+		t.Fatal("subscribe = false, want true")
+	}
+	sub.catchUp()
+	f.publish(event(5), time.Time{})
+
+	if want := []uint64{2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestFeedStoreProducts(t *testing.T) {
+	f := newFeed()
+	got := make(map[string][]string)
+	subscribe := func(storeID string, filter subscription) {
+		record := func(event productEvent) {
+			got[storeID] = append(got[storeID], fmt.Sprintf("%s %s", event.Type, event.Product))
+		}
+		f.subscribe(&client{}, &feedSubscriber{tenantID: "a", storeID: storeID, filter: filter, send: record, replay: record}, 0)
+	}
+	teaDrinkers := subscription{Categories: []string{"Tea"}}
+	subscribe("S1", teaDrinkers)
+	subscribe("S2", teaDrinkers)
+	subscribe("S3", teaDrinkers)
+	subscribe("S4", subscription{Categories: []string{"Coffee"}})
+
+	deliver := func(offset int64, routingKey string, headers amqp091.Table, body string) {
+		headers["x-stream-offset"] = offset
+		headers["x-tenant-id"] = "a"
+		handleProductEvent(f, amqp091.Delivery{RoutingKey: routingKey, Headers: headers, Body: []byte(body)})
+	}
+	// An override carries the category of its product
+	deliver(0, topology.KeyStoreProductUpdate, amqp091.Table{"x-store-id": "S1"},
+		`{"storeid":"S1","itemcode":"A1","price":1.2,"available":true,"category":"Tea"}`)
+	// A catalog change reaches every store at its own price, except where
+	// the product is not sold
+	deliver(1, topology.KeyProductUpdate, amqp091.Table{
+		"x-store-overrides": `[{"storeid":"S1","price":1.2,"available":true},{"storeid":"S3","available":false}]`,
+	}, `{"itemcode":"A1","name":"Tea","price":1.5,"category":"Tea"}`)
+
+	want := map[string][]string{
+		"S1": {
+			protocol.TypeStoreProductUpdated + ` {"storeid":"S1","itemcode":"A1","price":1.2,"available":true,"category":"Tea"}`,
+			protocol.TypeProductUpdated + ` {"category":"Tea","itemcode":"A1","name":"Tea","price":1.2}`,
+		},
+		"S2": {protocol.TypeProductUpdated + ` {"itemcode":"A1","name":"Tea","price":1.5,"category":"Tea"}`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %q, want %q", got, want)
+	}
+}
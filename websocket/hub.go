@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"websocket/config"
+)
+
+const (
+	// Slow clients whose send queue is full either lose the message or are
+	// disconnected, as chosen by WS_SLOW_CLIENT_POLICY.
+	slowClientDrop       = "drop"
+	slowClientDisconnect = "disconnect"
+)
+
+// hubStats is served on the admin stats endpoint.
+type hubStats struct {
+	Clients           int    `json:"clients"`
+	Subscribers       int    `json:"subscribers"`
+	FeedSeq           uint64 `json:"feedseq"`
+	ConnectionsTotal  uint64 `json:"connectionstotal"`
+	MessagesSent      uint64 `json:"messagessent"`
+	MessagesDropped   uint64 `json:"messagesdropped"`
+	SlowDisconnects   uint64 `json:"slowdisconnects"`
+	HeartbeatTimeouts uint64 `json:"heartbeattimeouts"`
+	SlowClientPolicy  string `json:"slowclientpolicy"`
+	SendQueueSize     int    `json:"sendqueuesize"`
+	ShuttingDown      bool   `json:"shuttingdown"`
+}
+
+// hub tracks the connected clients so they can be counted, broadcast to and
+// closed together on shutdown.
+type hub struct {
+	mu       sync.Mutex
+	clients  map[*client]struct{}
+	closing  bool
+	drained  chan struct{}
+	policy   string
+	queueLen int
+
+	connectionsTotal  atomic.Uint64
+	messagesSent      atomic.Uint64
+	messagesDropped   atomic.Uint64
+	slowDisconnects   atomic.Uint64
+	heartbeatTimeouts atomic.Uint64
+}
+
+func newHub() *hub {
+	return &hub{
+		clients:  make(map[*client]struct{}),
+		drained:  make(chan struct{}),
+		policy:   config.GetSlowClientPolicy(),
+		queueLen: config.GetSendQueueSize(),
+	}
+}
+
+// register adds c to the hub. It reports false once the hub is shutting
+// down and no longer accepts clients.
+func (h *hub) register(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	h.connectionsTotal.Add(1)
+	return true
+}
+
+func (h *hub) unregister(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	if h.closing && len(h.clients) == 0 {
+		close(h.drained)
+	}
+}
+
+// broadcast queues v for every connected client.
+func (h *hub) broadcast(v interface{}) {
+	h.mu.Lock()
+	clients := make([]*client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.enqueue(v)
+	}
+}
+
+// shutdown stops accepting clients, asks every connected client to close
+// and waits until they are gone or ctx expires.
+func (h *hub) shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closing {
+		h.closing = true
+		if len(h.clients) == 0 {
+			close(h.drained)
+		}
+	}
+	clients := make([]*client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.close()
+	}
+
+	select {
+	case <-h.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *hub) stats() hubStats {
+	h.mu.Lock()
+	clients := len(h.clients)
+	closing := h.closing
+	h.mu.Unlock()
+
+	return hubStats{
+		Clients:           clients,
+		Subscribers:       catalogFeed.subscriberCount(),
+		FeedSeq:           catalogFeed.lastSeq(),
+		ConnectionsTotal:  h.connectionsTotal.Load(),
+		MessagesSent:      h.messagesSent.Load(),
+		MessagesDropped:   h.messagesDropped.Load(),
+		SlowDisconnects:   h.slowDisconnects.Load(),
+		HeartbeatTimeouts: h.heartbeatTimeouts.Load(),
+		SlowClientPolicy:  h.policy,
+		SendQueueSize:     h.queueLen,
+		ShuttingDown:      closing,
+	}
+}
+
+// accepting fails once the hub has started shutting down, so the instance is
+// taken out of rotation before its clients are closed.
+func (h *hub) accepting(context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return errors.New("shutting down")
+	}
+	return nil
+}
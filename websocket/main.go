@@ -1,101 +1,312 @@
 package main
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "log"
     "net/http"
+    "os"
+    "os/signal"
+    "regexp"
+    "syscall"
+    "time"
 
+    "github.com/google/uuid"
     "github.com/gorilla/websocket"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+
+    "websocket/config"
+    "websocket/protocol"
+
+    "common/health"
+    "common/requestid"
+    "common/tracing"
 )
 
+var auth *authenticator
+
 var upgrader = websocket.Upgrader{
     ReadBufferSize:  1024,
     WriteBufferSize: 1024,
+    Subprotocols:    []string{protocol.Subprotocol},
     CheckOrigin: func(r *http.Request) bool {
-        return true
+        return auth.checkOrigin(r)
     },
 }
 
+var tenantIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,32}$`)
+
+// resolveTenant returns the tenant named by the X-Tenant-ID header or, for
+// browsers that cannot set headers on a WebSocket handshake, the tenant
+// query parameter.
+func resolveTenant(r *http.Request) string {
+    if tenantID := r.Header.Get("X-Tenant-ID"); tenantID != "" {
+        return tenantID
+    }
+    return r.URL.Query().Get("tenant")
+}
+
+// resolveStore returns the store named by the X-Store-ID header or the store
+// query parameter.
+func resolveStore(r *http.Request) string {
+    if storeID := r.Header.Get("X-Store-ID"); storeID != "" {
+        return storeID
+    }
+    return r.URL.Query().Get("store")
+}
+
+// products, wsHub and auth are set up by main once the configuration is
+// loaded.
+var (
+    products    *productClient
+    catalogFeed = newFeed()
+    wsHub       *hub
+
+    // checker backs the /healthz and /readyz endpoints
+    checker = &health.Checker{}
+)
+
 func websocketHandler(w http.ResponseWriter, r *http.Request) {
+    s, err := auth.authenticate(r)
+    if err != nil {
+        log.Printf("Rejected WebSocket handshake from %s: %v", r.RemoteAddr, err)
+        if errors.Is(err, errIdentityClash) {
+            http.Error(w, err.Error(), http.StatusForbidden)
+        } else {
+            http.Error(w, err.Error(), http.StatusUnauthorized)
+        }
+        return
+    }
+    if s.tenantID != "" && !tenantIDPattern.MatchString(s.tenantID) {
+        http.Error(w, "Invalid tenant ID", http.StatusBadRequest)
+        return
+    }
+
     // Upgrade HTTP connection to WebSocket
     conn, err := upgrader.Upgrade(w, r, nil)
     if err != nil {
         log.Println("Upgrade:", err)
         return
     }
-    defer conn.Close()
 
-    for {
-        // Read message from WebSocket client
-        _, message, err := conn.ReadMessage() // Removed messageType variable as it's not needed
-        if err != nil {
-            log.Println("Read:", err)
-            break
+    c := newClient(wsHub, conn, s)
+    if !wsHub.register(c) {
+        conn.WriteControl(websocket.CloseMessage,
+            websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "server is shutting down"), time.Now().Add(writeWait))
+        conn.Close()
+        return
+    }
+    defer wsHub.unregister(c)
+    defer catalogFeed.unsubscribe(c)
+
+    go c.writePump()
+    c.readPump(func(message []byte) {
+        handleMessage(r.Context(), c, message)
+    })
+}
+
+func handleMessage(ctx context.Context, c *client, frame []byte) {
+    env, perr := protocol.Decode(frame)
+    if perr != nil {
+        log.Printf("Rejected frame from tenant %q store %q: %v", c.tenantID, c.storeID, perr)
+        frameType := env.Type
+        if perr.Code == protocol.CodeUnknownType || perr.Code == protocol.CodeMalformedFrame {
+            // Keep client-chosen strings out of the metric labels
+            frameType = "unknown"
         }
+        framesReceived.WithLabelValues(frameType, perr.Code).Inc()
+        c.enqueue(protocol.NewError(env.ID, perr))
+        return
+    }
+    if perr := authorize(c.session, env); perr != nil {
+        log.Printf("Refused %s from terminal %q: %v", env.Type, c.terminalID, perr)
+        framesReceived.WithLabelValues(env.Type, perr.Code).Inc()
+        c.enqueue(protocol.NewError(env.ID, perr))
+        return
+    }
+    framesReceived.WithLabelValues(env.Type, "accepted").Inc()
+
+    // Each frame is its own request to product-service and the logs
+    ctx = requestid.With(ctx, uuid.NewString())
+    ctx, span := tracing.Tracer().Start(ctx, "handle "+env.Type, trace.WithAttributes(
+        attribute.String("ws.terminal", c.terminalID),
+        attribute.String("ws.tenant", c.tenantID),
+        attribute.String("ws.store", c.storeID),
+    ))
+    defer span.End()
 
-        // Handle message
-        var msg map[string]interface{}
-        if err := json.Unmarshal(message, &msg); err != nil {
-            log.Println("JSON unmarshal:", err)
-            continue
+    switch payload := env.Payload.(type) {
+    case *protocol.Product:
+        // Forward insert or update to product-service
+        var product json.RawMessage
+        var err error
+        requestid.Logf(ctx, "%s from terminal %q for tenant %q store %q: %s", env.Type, c.terminalID, c.tenantID, c.storeID, payload.ItemCode)
+        if env.Type == protocol.TypeProductInsert {
+            product, err = products.InsertProduct(ctx, c.session, payload)
+        } else {
+            product, err = products.UpdateProduct(ctx, c.session, payload)
         }
+        if err != nil {
+            requestid.Logf(ctx, "%s failed: %v", env.Type, err)
+            c.enqueue(protocol.NewError(env.ID, productServiceErrorOf(err)))
+            return
+        }
+        c.enqueue(protocol.NewEnvelope(protocol.TypeAck, env.ID, protocol.Ack{Product: product}))
 
-        action, ok := msg["action"].(string)
-        if !ok {
-            log.Println("Action is not a string")
-            continue
+    case *protocol.Subscribe:
+        // Subscribe to catalog changes, optionally replaying the ones
+        // missed since resumefrom
+        sub := &feedSubscriber{
+            tenantID: c.tenantID,
+            storeID:  c.storeID,
+            filter:   subscription{Categories: payload.Categories, ItemCodes: payload.ItemCodes},
+            send: func(event productEvent) {
+                c.enqueue(protocol.NewEnvelope(event.Type, "", event.ProductEvent))
+            },
+            replay: func(event productEvent) {
+                c.enqueueWait(protocol.NewEnvelope(event.Type, "", event.ProductEvent))
+            },
+            room: c.queueRoom,
         }
+        if catalogFeed.subscribe(c, sub, payload.ResumeFrom) {
+            // Replay outside the feed's lock, waiting for the client to
+            // take the missed changes rather than dropping them
+            sub.catchUp()
+            c.enqueueWait(protocol.NewEnvelope(protocol.TypeAck, env.ID, protocol.Ack{Seq: catalogFeed.lastSeq()}))
+        } else {
+            // Too far behind to replay, the client reloads the catalog
+            // and resumes from seq
+            c.enqueue(protocol.NewEnvelope(protocol.TypeResync, env.ID, protocol.Resync{Seq: catalogFeed.lastSeq()}))
+        }
+
+    case *protocol.SyncSnapshotRequest:
+        body, err := products.SyncSnapshot(ctx, c.session)
+        replySync(c, env, protocol.TypeSyncSnapshotResult, body, err, &protocol.SyncSnapshot{})
 
-        // Handle insert or update action
-        switch action {
-        case "insert":
-            // Simulate backend processing (replace with actual logic)
-            product := msg["product"].(map[string]interface{})
-            log.Println("Inserting product:", product)
-
-            // Simulate success or failure
-            success := true // Replace with actual success condition
-            if success {
-                sendMessage(conn, "success", "Product inserted successfully")
-            } else {
-                sendMessage(conn, "error", "Failed to insert product")
-            }
-
-        case "update":
-            // Simulate backend processing (replace with actual logic)
-            updatedProduct := msg["product"].(map[string]interface{})
-            log.Println("Updating product:", updatedProduct)
-
-            // Simulate success or failure
-            success := true // Replace with actual success condition
-            if success {
-                sendMessage(conn, "success", "Product updated successfully")
-            } else {
-                sendMessage(conn, "error", "Failed to update product")
-            }
+    case *protocol.SyncChangesRequest:
+        body, err := products.SyncChanges(ctx, c.session, payload.Checkpoint, payload.Limit)
+        replySync(c, env, protocol.TypeSyncChangesResult, body, err, &protocol.SyncChanges{})
+
+    case *protocol.SyncPush:
+        if c.terminalID != "" {
+            payload.TerminalID = c.terminalID
         }
+        body, err := products.SyncPush(ctx, c.session, payload)
+        replySync(c, env, protocol.TypeSyncPushResult, body, err, &protocol.SyncPushResult{})
+
+    case *protocol.Unsubscribe:
+        catalogFeed.unsubscribe(c)
+        c.enqueue(protocol.NewEnvelope(protocol.TypeAck, env.ID, protocol.Ack{}))
+    }
+}
+
+// replySync answers a sync request with product-service's response body
+// decoded into result.
+func replySync(c *client, env protocol.Envelope, replyType string, body json.RawMessage, err error, result interface{}) {
+    if err != nil {
+        log.Printf("%s failed: %v", env.Type, err)
+        c.enqueue(protocol.NewError(env.ID, productServiceErrorOf(err)))
+        return
+    }
+    if err := json.Unmarshal(body, result); err != nil {
+        log.Printf("Decode %s response: %v", env.Type, err)
+        c.enqueue(protocol.NewError(env.ID, &protocol.Error{Code: protocol.CodeUpstreamError, Message: "Unexpected product-service response"}))
+        return
     }
+    c.enqueue(protocol.NewEnvelope(replyType, env.ID, result))
 }
 
-func sendMessage(conn *websocket.Conn, messageType string, message string) {
-    // Send message back to WebSocket client
-    msg := map[string]string{
-        "type":  messageType,
-        "error": message,
+// productServiceErrorOf maps a failed product-service call to the error
+// reply sent to the client.
+func productServiceErrorOf(err error) *protocol.Error {
+    var serviceErr *productServiceError
+    if !errors.As(err, &serviceErr) {
+        return &protocol.Error{Code: protocol.CodeUpstreamUnavailable, Message: "product-service could not be reached"}
     }
-    if err := conn.WriteJSON(msg); err != nil {
-        log.Println("WriteJSON:", err)
+
+    switch {
+    case serviceErr.Status == http.StatusNotFound:
+        return &protocol.Error{Code: protocol.CodeNotFound, Message: serviceErr.Message}
+    case serviceErr.Status == http.StatusConflict:
+        return &protocol.Error{Code: protocol.CodeConflict, Message: serviceErr.Message}
+    case serviceErr.Status == http.StatusUnauthorized || serviceErr.Status == http.StatusForbidden:
+        return &protocol.Error{Code: protocol.CodeForbidden, Message: serviceErr.Message}
+    case serviceErr.Status < http.StatusInternalServerError:
+        return &protocol.Error{Code: protocol.CodeInvalidPayload, Message: serviceErr.Message}
     }
+    return &protocol.Error{Code: protocol.CodeUpstreamError, Message: serviceErr.Message}
+}
+
+// statsHandler serves the hub's connection and delivery counters.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(wsHub.stats())
 }
 
+// serviceName names this service in traces.
+const serviceName = "websocket"
+
 func main() {
+    // Load and validate the configuration
+    config.LoadConfig()
+    auth = newAuthenticator()
+    products = newProductClient()
+    wsHub = newHub()
+
+    shutdownTracing, err := tracing.Init(context.Background(), serviceName, config.GetTraceExporter(), config.GetTraceFile())
+    if err != nil {
+        log.Fatalf("Failed to initialize tracing: %v", err)
+    }
+    defer shutdownTracing(context.Background())
+
     // Serve static files (frontend.html)
     http.Handle("/", http.FileServer(http.Dir(".")))
 
+    checker.AddReadiness("hub", wsHub.accepting)
+    checker.AddReadiness("product-service", products.ping)
+
+    // Push catalog changes to subscribed clients
+    rabbitMQ, err := consumeProductEvents(catalogFeed)
+    if err != nil {
+        log.Fatalf("Failed to consume product events: %v", err)
+    }
+    defer rabbitMQ.Close()
+
     // WebSocket handler
     http.HandleFunc("/ws", websocketHandler)
+    http.HandleFunc("/admin/stats", statsHandler)
+    http.Handle("/metrics", promhttp.Handler())
+    http.HandleFunc("/healthz", checker.Healthz)
+    http.HandleFunc("/readyz", checker.Readyz)
 
     // Start server
-    log.Println("Server running on http://localhost:3000")
-    log.Fatal(http.ListenAndServe(":3000", nil))
+    server := &http.Server{Addr: config.GetHTTPAddr()}
+    go func() {
+        log.Printf("Server running on %s", server.Addr)
+        if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            log.Fatal(err)
+        }
+    }()
+
+    // Wait for a shutdown signal, then stop the catalog feed, stop
+    // accepting connections and close the connected clients
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+    <-ctx.Done()
+    log.Println("Shutting down")
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), config.GetShutdownTimeout())
+    defer cancel()
+    if err := rabbitMQ.StopConsuming(shutdownCtx); err != nil {
+        log.Printf("Product events did not drain in time: %v", err)
+    }
+    if err := server.Shutdown(shutdownCtx); err != nil {
+        log.Printf("HTTP server shutdown: %v", err)
+    }
+    if err := wsHub.shutdown(shutdownCtx); err != nil {
+        log.Printf("WebSocket clients did not close in time: %v", err)
+    }
 }
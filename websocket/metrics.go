@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// framesReceived counts client frames by message type and whether they
+// were accepted.
+var framesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "websocket_frames_received_total",
+	Help: "Frames received from clients by message type and result.",
+}, []string{"type", "result"})
+
+// The hub metrics read the counters the hub already keeps for the admin
+// stats endpoint.
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "websocket_connections",
+		Help: "Live WebSocket connections.",
+	}, func() float64 {
+		wsHub.mu.Lock()
+		defer wsHub.mu.Unlock()
+		return float64(len(wsHub.clients))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "websocket_catalog_subscribers",
+		Help: "Connections subscribed to the catalog feed.",
+	}, func() float64 { return float64(catalogFeed.subscriberCount()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "websocket_connections_total",
+		Help: "WebSocket connections accepted since start.",
+	}, func() float64 { return float64(wsHub.connectionsTotal.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "websocket_messages_sent_total",
+		Help: "Messages written to clients.",
+	}, func() float64 { return float64(wsHub.messagesSent.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "websocket_messages_dropped_total",
+		Help: "Messages dropped because a client's send queue was full.",
+	}, func() float64 { return float64(wsHub.messagesDropped.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "websocket_slow_disconnects_total",
+		Help: "Clients disconnected for falling behind.",
+	}, func() float64 { return float64(wsHub.slowDisconnects.Load()) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "websocket_heartbeat_timeouts_total",
+		Help: "Clients disconnected for missing heartbeats.",
+	}, func() float64 { return float64(wsHub.heartbeatTimeouts.Load()) })
+}
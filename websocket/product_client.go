@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"websocket/config"
+
+	"common/requestid"
+	"common/tracing"
+)
+
+// session identifies who a WebSocket connection acts for when it calls
+// product-service.
+type session struct {
+	terminalID string
+	tenantID   string
+	storeID    string
+}
+
+// productServiceError is returned when product-service answers a request
+// with an error status.
+type productServiceError struct {
+	Status  int
+	Message string
+}
+
+func (e *productServiceError) Error() string {
+	return fmt.Sprintf("product-service returned %d: %s", e.Status, e.Message)
+}
+
+// productClient forwards catalog changes to product-service's HTTP API,
+// authenticated with the product-service token of the session's tenant.
+type productClient struct {
+	baseURL    string
+	tokens     map[string]string
+	httpClient *http.Client
+}
+
+func newProductClient() *productClient {
+	return &productClient{
+		baseURL:    strings.TrimSuffix(config.GetProductServiceURL(), "/"),
+		tokens:     config.GetProductServiceTokens(),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *productClient) InsertProduct(ctx context.Context, s session, product interface{}) (json.RawMessage, error) {
+	return c.do(ctx, s, http.MethodPost, "/product/insert", product)
+}
+
+func (c *productClient) UpdateProduct(ctx context.Context, s session, product interface{}) (json.RawMessage, error) {
+	return c.do(ctx, s, http.MethodPut, "/product/update", product)
+}
+
+func (c *productClient) SyncSnapshot(ctx context.Context, s session) (json.RawMessage, error) {
+	return c.do(ctx, s, http.MethodGet, "/sync/snapshot", nil)
+}
+
+func (c *productClient) SyncChanges(ctx context.Context, s session, checkpoint string, limit int) (json.RawMessage, error) {
+	query := url.Values{}
+	query.Set("checkpoint", checkpoint)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	return c.do(ctx, s, http.MethodGet, "/sync/changes?"+query.Encode(), nil)
+}
+
+func (c *productClient) SyncPush(ctx context.Context, s session, push interface{}) (json.RawMessage, error) {
+	return c.do(ctx, s, http.MethodPost, "/sync/push", push)
+}
+
+// do calls product-service on behalf of s. A nil payload sends no body.
+func (c *productClient) do(ctx context.Context, s session, method, path string, payload interface{}) (json.RawMessage, error) {
+	token, ok := c.tokens[s.tenantID]
+	if !ok {
+		return nil, fmt.Errorf("no product-service token for tenant %q", s.tenantID)
+	}
+	var body io.Reader
+	if payload != nil {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payloadJSON)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, method+" "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", method), attribute.String("url.path", path)))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if requestID := requestid.FromContext(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.tenantID != "" {
+		req.Header.Set("X-Tenant-ID", s.tenantID)
+	}
+	if s.storeID != "" {
+		req.Header.Set("X-Store-ID", s.storeID)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var errorBody struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &errorBody); err != nil || errorBody.Error == "" {
+			errorBody.Error = http.StatusText(resp.StatusCode)
+		}
+		return nil, &productServiceError{Status: resp.StatusCode, Message: errorBody.Error}
+	}
+	return respBody, nil
+}
+
+// ping checks that product-service reports itself ready.
+func (c *productClient) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("product-service is not ready: %s", resp.Status)
+	}
+	return nil
+}
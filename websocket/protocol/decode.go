@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var (
+	envelopeSchema = SchemaOf(Envelope{})
+
+	// clientMessages maps the types clients may send to their payload
+	// type and schema.
+	clientMessages = map[string]struct {
+		payload reflect.Type
+		schema  Schema
+	}{}
+)
+
+func init() {
+	for _, m := range Messages {
+		if m.Direction != ClientToServer {
+			continue
+		}
+		clientMessages[m.Type] = struct {
+			payload reflect.Type
+			schema  Schema
+		}{reflect.TypeOf(m.Payload), SchemaOf(m.Payload)}
+	}
+}
+
+// Decode validates a frame received from a client. On success the returned
+// envelope's Payload holds a pointer to the payload type of its Type. On
+// failure the envelope carries whatever ID could be read, so the error can
+// be matched to the request.
+func Decode(frame []byte) (Envelope, *Error) {
+	var env Envelope
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return env, &Error{Code: CodeMalformedFrame, Message: "Frame is not valid JSON"}
+	}
+	if fields, ok := doc.(map[string]interface{}); ok {
+		env.ID, _ = fields["id"].(string)
+	}
+	if problems := validate(envelopeSchema, doc, ""); len(problems) > 0 {
+		sort.Strings(problems)
+		return env, &Error{Code: CodeMalformedFrame, Message: "Frame does not match the envelope schema", Details: problems}
+	}
+
+	var raw struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+		Version int             `json:"version"`
+	}
+	if err := json.Unmarshal(frame, &raw); err != nil {
+		return env, &Error{Code: CodeMalformedFrame, Message: err.Error()}
+	}
+	env.Type, env.Version = raw.Type, raw.Version
+
+	if raw.Version != Version {
+		return env, &Error{Code: CodeUnsupportedVersion, Message: "Only protocol version " + strconv.Itoa(Version) + " is supported"}
+	}
+	message, ok := clientMessages[raw.Type]
+	if !ok {
+		return env, &Error{Code: CodeUnknownType, Message: "Unknown message type " + raw.Type}
+	}
+
+	if len(raw.Payload) == 0 {
+		raw.Payload = json.RawMessage("{}")
+	}
+	var payloadDoc interface{}
+	decoder = json.NewDecoder(bytes.NewReader(raw.Payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payloadDoc); err != nil {
+		return env, &Error{Code: CodeMalformedFrame, Message: "Payload is not valid JSON"}
+	}
+	if problems := validate(message.schema, payloadDoc, "payload"); len(problems) > 0 {
+		sort.Strings(problems)
+		return env, &Error{Code: CodeInvalidPayload, Message: "Payload does not match the " + raw.Type + " schema", Details: problems}
+	}
+
+	payload := reflect.New(message.payload)
+	if err := json.Unmarshal(raw.Payload, payload.Interface()); err != nil {
+		return env, &Error{Code: CodeInvalidPayload, Message: err.Error()}
+	}
+	env.Payload = payload.Interface()
+	return env, nil
+}
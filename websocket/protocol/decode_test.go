@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       string
+		wantID      string
+		wantCode    string
+		wantDetails []string
+	}{
+		{
+			name:     "not json",
+			frame:    `{"type":`,
+			wantCode: CodeMalformedFrame,
+		},
+		{
+			name:        "not an object",
+			frame:       `["product.insert"]`,
+			wantCode:    CodeMalformedFrame,
+			wantDetails: []string{"(root): expected object"},
+		},
+		{
+			name:     "envelope violations",
+			frame:    `{"id":"r1","type":"","version":"1","extra":true}`,
+			wantID:   "r1",
+			wantCode: CodeMalformedFrame,
+			wantDetails: []string{
+				"extra: is not allowed",
+				"type: must be at least 1 characters",
+				"version: expected integer",
+			},
+		},
+		{
+			name:        "missing version",
+			frame:       `{"id":"r1","type":"catalog.unsubscribe"}`,
+			wantID:      "r1",
+			wantCode:    CodeMalformedFrame,
+			wantDetails: []string{"version: is required"},
+		},
+		{
+			name:     "unsupported version",
+			frame:    `{"id":"r1","type":"catalog.unsubscribe","version":2}`,
+			wantID:   "r1",
+			wantCode: CodeUnsupportedVersion,
+		},
+		{
+			name:     "server message",
+			frame:    `{"id":"r1","type":"ack","version":1}`,
+			wantID:   "r1",
+			wantCode: CodeUnknownType,
+		},
+		{
+			name:     "payload violations",
+			frame:    `{"id":"r1","type":"product.insert","version":1,"payload":{"name":"","price":-1,"color":"red"}}`,
+			wantID:   "r1",
+			wantCode: CodeInvalidPayload,
+			wantDetails: []string{
+				"payload.color: is not allowed",
+				"payload.itemcode: is required",
+				"payload.name: must be at least 1 characters",
+				"payload.price: must be at least 0",
+			},
+		},
+		{
+			name:        "nested violations",
+			frame:       `{"type":"sync.push","version":1,"payload":{"ops":[{"opid":"o1","type":"product.delete","payload":{}},{"opid":7}]}}`,
+			wantCode:    CodeInvalidPayload,
+			wantDetails: []string{"payload.ops[0].createdat: is required", "payload.ops[1].createdat: is required", "payload.ops[1].opid: expected string", "payload.ops[1].payload: is required", "payload.ops[1].type: is required"},
+		},
+		{
+			name:        "negative resume",
+			frame:       `{"type":"catalog.subscribe","version":1,"payload":{"resumefrom":-1}}`,
+			wantCode:    CodeInvalidPayload,
+			wantDetails: []string{"payload.resumefrom: must be at least 0"},
+		},
+		{
+			name:        "fraction for integer",
+			frame:       `{"type":"sync.changes","version":1,"payload":{"checkpoint":"YzEuMA","limit":1.5}}`,
+			wantCode:    CodeInvalidPayload,
+			wantDetails: []string{"payload.limit: expected integer"},
+		},
+		{
+			name:   "valid",
+			frame:  `{"id":"r1","type":"product.insert","version":1,"payload":{"itemcode":"A1","name":"Tea","price":1.5}}`,
+			wantID: "r1",
+		},
+		{
+			name:  "valid without payload",
+			frame: `{"type":"catalog.unsubscribe","version":1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := Decode([]byte(tt.frame))
+			if env.ID != tt.wantID {
+				t.Errorf("id = %q, want %q", env.ID, tt.wantID)
+			}
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Decode = nil, want %s", tt.wantCode)
+			}
+			if err.Code != tt.wantCode {
+				t.Errorf("code = %s, want %s (%v)", err.Code, tt.wantCode, err)
+			}
+			if !reflect.DeepEqual(err.Details, tt.wantDetails) {
+				t.Errorf("details = %q, want %q", err.Details, tt.wantDetails)
+			}
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	env, err := Decode([]byte(`{"type":"catalog.subscribe","version":1,"payload":{"categories":["drinks"],"resumefrom":42}}`))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	got, ok := env.Payload.(*Subscribe)
+	if !ok {
+		t.Fatalf("payload = %T, want *Subscribe", env.Payload)
+	}
+	want := Subscribe{Categories: []string{"drinks"}, ResumeFrom: 42}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("payload = %+v, want %+v", *got, want)
+	}
+	if env.Type != TypeSubscribe || env.Version != Version {
+		t.Errorf("envelope = %s v%d, want %s v%d", env.Type, env.Version, TypeSubscribe, Version)
+	}
+}
@@ -0,0 +1,49 @@
+package protocol
+
+import "strings"
+
+// Error codes carried by error replies.
+const (
+	CodeMalformedFrame      = "malformed_frame"
+	CodeUnsupportedVersion  = "unsupported_version"
+	CodeUnknownType         = "unknown_type"
+	CodeInvalidPayload      = "invalid_payload"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeForbidden           = "forbidden"
+	CodeUpstreamError       = "upstream_error"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeInternal            = "internal"
+)
+
+// ErrorCodes describes every error code, in the order they are documented.
+var ErrorCodes = []struct {
+	Code        string
+	Description string
+}{
+	{CodeMalformedFrame, "The frame is not JSON or its envelope does not match the envelope schema."},
+	{CodeUnsupportedVersion, "The envelope version is not spoken by this server."},
+	{CodeUnknownType, "The envelope type is not a message clients may send."},
+	{CodeInvalidPayload, "The payload does not match the schema of its type, or product-service rejected it."},
+	{CodeNotFound, "The product does not exist."},
+	{CodeConflict, "The change conflicts with the current state of the product."},
+	{CodeForbidden, "The connection may not perform the request."},
+	{CodeUpstreamError, "product-service failed to handle the request."},
+	{CodeUpstreamUnavailable, "product-service could not be reached."},
+	{CodeInternal, "The server failed to handle the request."},
+}
+
+// Error is the payload of an error reply. Details lists the individual
+// schema violations of invalid frames.
+type Error struct {
+	Code    string   `json:"code" schema:"required" doc:"Machine-readable error code."`
+	Message string   `json:"message" schema:"required" doc:"Human-readable description."`
+	Details []string `json:"details,omitempty" doc:"Individual problems found in the frame."`
+}
+
+func (e *Error) Error() string {
+	if len(e.Details) == 0 {
+		return e.Code + ": " + e.Message
+	}
+	return e.Code + ": " + e.Message + ": " + strings.Join(e.Details, "; ")
+}
@@ -0,0 +1,221 @@
+// Package protocol defines the frames exchanged with terminals over the
+// WebSocket connection. Every frame is an Envelope whose payload depends on
+// its type. The Go types below are the single source of the JSON schemas
+// incoming frames are validated against and of the generated PROTOCOL.md.
+package protocol
+
+//go:generate go run ../cmd/protocoldoc -o ../PROTOCOL.md
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Version is the protocol version this server speaks. Frames carrying any
+// other version are rejected with CodeUnsupportedVersion.
+const Version = 1
+
+// Subprotocol is offered in Sec-WebSocket-Protocol by browsers, which cannot
+// set headers on the handshake, together with their terminal token as
+// TokenSubprotocolPrefix followed by the token.
+const (
+	Subprotocol            = "mspos.v1"
+	TokenSubprotocolPrefix = "token."
+)
+
+// Envelope wraps every frame. Payload holds one of the payload types below,
+// as listed for Type in Messages.
+type Envelope struct {
+	Type    string      `json:"type" schema:"required,minLength=1" doc:"Message type, one of the types listed below."`
+	ID      string      `json:"id,omitempty" schema:"maxLength=64" doc:"Request ID chosen by the client and echoed on the reply."`
+	Payload interface{} `json:"payload,omitempty" doc:"Type specific payload."`
+	Version int         `json:"version" schema:"required,minimum=1" doc:"Protocol version the frame was written for."`
+}
+
+// Message types sent by clients.
+const (
+	TypeProductInsert = "product.insert"
+	TypeProductUpdate = "product.update"
+	TypeSubscribe     = "catalog.subscribe"
+	TypeUnsubscribe   = "catalog.unsubscribe"
+	TypeSyncSnapshot  = "sync.snapshot"
+	TypeSyncChanges   = "sync.changes"
+	TypeSyncPush      = "sync.push"
+)
+
+// Message types sent by the server.
+const (
+	TypeAck            = "ack"
+	TypeError          = "error"
+	TypeResync         = "catalog.resync"
+	TypeProductCreated = "product.created"
+	TypeProductUpdated = "product.updated"
+	TypeProductDeleted = "product.deleted"
+	// TypeStoreProductUpdated carries a store's price override or
+	// availability, only to connections of that store.
+	TypeStoreProductUpdated = "store.product.updated"
+
+	TypeSyncSnapshotResult = "sync.snapshot.result"
+	TypeSyncChangesResult  = "sync.changes.result"
+	TypeSyncPushResult     = "sync.push.result"
+)
+
+// Product is a catalog product as accepted by product-service.
+type Product struct {
+	ItemCode string  `json:"itemcode" schema:"required,minLength=1,maxLength=64" doc:"Unique item code."`
+	Name     string  `json:"name" schema:"required,minLength=1" doc:"Product name."`
+	Price    float64 `json:"price" schema:"minimum=0" doc:"Master price."`
+	Category string  `json:"category" doc:"Category used by subscription filters."`
+	Jenis    string  `json:"jenis" doc:"Product kind."`
+}
+
+// Subscribe filters the catalog changes a client receives. Empty filters
+// match every product.
+type Subscribe struct {
+	Categories []string `json:"categories,omitempty" doc:"Categories to receive changes for."`
+	ItemCodes  []string `json:"itemcodes,omitempty" doc:"Item codes to receive changes for."`
+	ResumeFrom uint64   `json:"resumefrom,omitempty" doc:"Last seq the client saw; later changes are replayed first."`
+}
+
+// Unsubscribe stops the catalog changes of a client.
+type Unsubscribe struct{}
+
+// Ack is the successful reply to a request.
+type Ack struct {
+	Product json.RawMessage `json:"product,omitempty" doc:"Product as stored by product-service."`
+	Seq     uint64          `json:"seq,omitempty" doc:"Latest catalog seq, on subscribe replies."`
+}
+
+// Resync tells a subscriber that the changes it missed are no longer kept,
+// or too many to replay.
+// The client reloads the catalog and resubscribes from Seq.
+type Resync struct {
+	Seq uint64 `json:"seq" doc:"Seq to resume from after reloading."`
+}
+
+// ProductEvent is a catalog change pushed to subscribers. Seq is the
+// position of the change in the catalog change stream, so it is the same on
+// every server and a client may resume from it on any of them.
+type ProductEvent struct {
+	Seq      uint64          `json:"seq" doc:"Sequence number of the change, shared by all servers."`
+	StoreID  string          `json:"storeid,omitempty" doc:"Store the change applies to, empty for master data."`
+	ItemCode string          `json:"itemcode" doc:"Item code of the changed product."`
+	Category string          `json:"category" doc:"Category of the changed product."`
+	Product  json.RawMessage `json:"product" doc:"Product after the change, at the price of the connection's store, or as it was before deletion; the store product for store.product.updated."`
+	Time     time.Time       `json:"time" doc:"When the change was published."`
+}
+
+// SyncSnapshotRequest asks for the full catalog of the connection's store.
+type SyncSnapshotRequest struct{}
+
+// SyncChangesRequest asks for the items changed since Checkpoint.
+type SyncChangesRequest struct {
+	Checkpoint string `json:"checkpoint" schema:"required" doc:"Checkpoint of the last snapshot or changes applied."`
+	Limit      int    `json:"limit,omitempty" schema:"minimum=0" doc:"Maximum changes to read, 500 when omitted."`
+}
+
+// SyncOp is an operation a terminal recorded while offline.
+type SyncOp struct {
+	OpID           string          `json:"opid" schema:"required,minLength=1,maxLength=64" doc:"ID generated by the terminal; pushing it again returns the first outcome."`
+	Type           string          `json:"type" schema:"required,minLength=1" doc:"product.upsert, product.delete, store.product.update, shift.taking, shift.cash or refund.create."`
+	CreatedAt      time.Time       `json:"createdat" schema:"required" doc:"When the operation was recorded; operations are applied in this order."`
+	BaseCheckpoint string          `json:"basecheckpoint,omitempty" doc:"Checkpoint the terminal had synced to when the operation was recorded."`
+	Payload        json.RawMessage `json:"payload" schema:"required" doc:"Body of the matching product-service request."`
+}
+
+// SyncPush sends queued offline operations.
+type SyncPush struct {
+	TerminalID string   `json:"terminalid,omitempty" doc:"Terminal the operations come from; authenticated connections use their own."`
+	Ops        []SyncOp `json:"ops" schema:"required" doc:"Operations in any order."`
+}
+
+// SyncItem is a catalog product as it is sold in the connection's store.
+type SyncItem struct {
+	ItemCode  string  `json:"itemcode" doc:"Item code."`
+	Name      string  `json:"name,omitempty" doc:"Product name."`
+	Price     float64 `json:"price,omitempty" doc:"Price in this store."`
+	Category  string  `json:"category,omitempty" doc:"Category."`
+	Jenis     string  `json:"jenis,omitempty" doc:"Product kind."`
+	Available bool    `json:"available" doc:"Whether the store sells the product."`
+	Deleted   bool    `json:"deleted,omitempty" doc:"The product was deleted and should be dropped."`
+}
+
+// SyncSnapshot is the full catalog of a store.
+type SyncSnapshot struct {
+	Checkpoint string     `json:"checkpoint" doc:"Checkpoint to ask for changes from."`
+	Items      []SyncItem `json:"items" doc:"Every product of the catalog."`
+}
+
+// SyncChanges is the current state of the items changed since a checkpoint.
+type SyncChanges struct {
+	Checkpoint string     `json:"checkpoint" doc:"Checkpoint to ask for further changes from."`
+	Items      []SyncItem `json:"items" doc:"Changed items, each sent once."`
+	HasMore    bool       `json:"hasmore" doc:"More changes are waiting; ask again from checkpoint."`
+	Resync     bool       `json:"resync,omitempty" doc:"The checkpoint is unknown; take a new snapshot."`
+}
+
+// SyncOpResult is the outcome of one pushed operation.
+type SyncOpResult struct {
+	OpID      string          `json:"opid" doc:"ID of the operation."`
+	Type      string          `json:"type" doc:"Type of the operation."`
+	Status    string          `json:"status" doc:"applied, conflict or rejected."`
+	Error     string          `json:"error,omitempty" doc:"Why the operation was not applied."`
+	Item      *SyncItem       `json:"item,omitempty" doc:"Server version of the product, which won the conflict."`
+	Result    json.RawMessage `json:"result,omitempty" doc:"What product-service stored for the operation."`
+	Duplicate bool            `json:"duplicate,omitempty" doc:"The operation was pushed before; this is its first outcome."`
+}
+
+// SyncPushResult lists the outcome of every pushed operation in the order
+// they were applied.
+type SyncPushResult struct {
+	Checkpoint string         `json:"checkpoint" doc:"Latest checkpoint after applying the operations."`
+	Results    []SyncOpResult `json:"results" doc:"Outcome of each operation."`
+}
+
+// Direction tells who sends a message type.
+type Direction string
+
+const (
+	ClientToServer Direction = "client"
+	ServerToClient Direction = "server"
+)
+
+// Message describes one message type. Payload is a zero value of its
+// payload type.
+type Message struct {
+	Type        string
+	Direction   Direction
+	Payload     interface{}
+	Description string
+}
+
+// Messages lists every message type of the protocol.
+var Messages = []Message{
+	{TypeProductInsert, ClientToServer, Product{}, "Inserts a product through product-service. Answered by ack with the stored product, or error."},
+	{TypeProductUpdate, ClientToServer, Product{}, "Updates a product through product-service. Answered by ack with the stored product, or error."},
+	{TypeSubscribe, ClientToServer, Subscribe{}, "Subscribes to catalog changes, replacing any earlier subscription. Answered by ack with the latest seq, or catalog.resync."},
+	{TypeUnsubscribe, ClientToServer, Unsubscribe{}, "Stops catalog changes. Answered by ack."},
+	{TypeSyncSnapshot, ClientToServer, SyncSnapshotRequest{}, "Fetches the full catalog of the connection's store. Answered by sync.snapshot.result, or error."},
+	{TypeSyncChanges, ClientToServer, SyncChangesRequest{}, "Fetches the items changed since a checkpoint. Answered by sync.changes.result, or error."},
+	{TypeSyncPush, ClientToServer, SyncPush{}, "Pushes operations queued while offline. Answered by sync.push.result, or error."},
+	{TypeAck, ServerToClient, Ack{}, "Successful reply to the request with the same id."},
+	{TypeError, ServerToClient, Error{}, "Failed reply to the request with the same id, or to a frame that could not be read."},
+	{TypeResync, ServerToClient, Resync{}, "Reply to catalog.subscribe when the missed changes are no longer kept or too many to replay."},
+	{TypeProductCreated, ServerToClient, ProductEvent{}, "A product was inserted."},
+	{TypeProductUpdated, ServerToClient, ProductEvent{}, "A product was updated."},
+	{TypeProductDeleted, ServerToClient, ProductEvent{}, "A product was deleted."},
+	{TypeStoreProductUpdated, ServerToClient, ProductEvent{}, "The price override or availability of a product changed in the connection's store; product carries the store product."},
+	{TypeSyncSnapshotResult, ServerToClient, SyncSnapshot{}, "Reply to sync.snapshot."},
+	{TypeSyncChangesResult, ServerToClient, SyncChanges{}, "Reply to sync.changes."},
+	{TypeSyncPushResult, ServerToClient, SyncPushResult{}, "Reply to sync.push. Catalog edits lose to changes made elsewhere after their base checkpoint; conflicts carry the server's version."},
+}
+
+// NewEnvelope wraps payload in an envelope of the current version.
+func NewEnvelope(msgType, id string, payload interface{}) Envelope {
+	return Envelope{Type: msgType, ID: id, Payload: payload, Version: Version}
+}
+
+// NewError wraps err in an error reply to request id.
+func NewError(id string, err *Error) Envelope {
+	return NewEnvelope(TypeError, id, err)
+}
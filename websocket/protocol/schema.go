@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema document.
+type Schema map[string]interface{}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// SchemaOf builds the JSON schema of v's type. Struct fields are described
+// by their json tag, their doc tag and a schema tag of comma separated
+// constraints: required, minLength=N, maxLength=N and minimum=N.
+func SchemaOf(v interface{}) Schema {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type) Schema {
+	if t == nil {
+		return Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == rawMessageType:
+		return Schema{}
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer", "minimum": 0.0}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Interface, reflect.Map:
+		return Schema{"type": "object"}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return Schema{}
+}
+
+func structSchema(t reflect.Type) Schema {
+	properties := Schema{}
+	required := []interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOf(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			property["description"] = doc
+		}
+		for _, option := range strings.Split(field.Tag.Get("schema"), ",") {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "required":
+				required = append(required, name)
+			case "minLength", "maxLength":
+				n, _ := strconv.Atoi(value)
+				property[key] = float64(n)
+			case "minimum":
+				n, _ := strconv.ParseFloat(value, 64)
+				property[key] = n
+			}
+		}
+		properties[name] = property
+	}
+
+	schema := Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// validate checks value, as decoded by a json.Decoder using UseNumber,
+// against schema and returns one message per violation found. Only the
+// keywords SchemaOf produces are understood.
+func validate(schema Schema, value interface{}, path string) []string {
+	var problems []string
+	if path == "" {
+		path = "(root)"
+	}
+
+	if expected, ok := schema["type"].(string); ok && !hasType(value, expected) {
+		return append(problems, path+": expected "+expected)
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			problems = append(problems, path+": must be at least "+formatNumber(min)+" characters")
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			problems = append(problems, path+": must be at most "+formatNumber(max)+" characters")
+		}
+
+	case json.Number:
+		n, _ := v.Float64()
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			problems = append(problems, path+": must be at least "+formatNumber(min))
+		}
+
+	case []interface{}:
+		if items, ok := schema["items"].(Schema); ok {
+			for i, item := range v {
+				problems = append(problems, validate(items, item, path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(Schema)
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					problems = append(problems, childPath(path, name.(string))+": is required")
+				}
+			}
+		}
+		for name, property := range v {
+			propertySchema, ok := properties[name].(Schema)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					problems = append(problems, childPath(path, name)+": is not allowed")
+				}
+				continue
+			}
+			problems = append(problems, validate(propertySchema, property, childPath(path, name))...)
+		}
+	}
+	return problems
+}
+
+func hasType(value interface{}, expected string) bool {
+	switch v := value.(type) {
+	case string:
+		return expected == "string"
+	case bool:
+		return expected == "boolean"
+	case json.Number:
+		if expected == "number" {
+			return true
+		}
+		_, err := v.Int64()
+		return expected == "integer" && err == nil
+	case []interface{}:
+		return expected == "array"
+	case map[string]interface{}:
+		return expected == "object"
+	}
+	return false
+}
+
+func childPath(path, name string) string {
+	if path == "(root)" {
+		return name
+	}
+	return path + "." + name
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchemaOf(t *testing.T) {
+	type item struct {
+		Code string `json:"code" schema:"required,minLength=1,maxLength=8" doc:"Item code."`
+	}
+	type request struct {
+		Items   []item          `json:"items" schema:"required"`
+		Count   uint32          `json:"count,omitempty"`
+		Price   float64         `json:"price" schema:"minimum=0.5"`
+		At      time.Time       `json:"at"`
+		Raw     json.RawMessage `json:"raw"`
+		Skipped string          `json:"-"`
+		hidden  string
+	}
+
+	want := Schema{
+		"type": "object",
+		"properties": Schema{
+			"items": Schema{"type": "array", "items": Schema{
+				"type": "object",
+				"properties": Schema{
+					"code": Schema{"type": "string", "minLength": 1.0, "maxLength": 8.0, "description": "Item code."},
+				},
+				"required":             []interface{}{"code"},
+				"additionalProperties": false,
+			}},
+			"count": Schema{"type": "integer", "minimum": 0.0},
+			"price": Schema{"type": "number", "minimum": 0.5},
+			"at":    Schema{"type": "string", "format": "date-time"},
+			"raw":   Schema{},
+		},
+		"required":             []interface{}{"items"},
+		"additionalProperties": false,
+	}
+	if got := SchemaOf(&request{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaOf = %v, want %v", got, want)
+	}
+}
+
+func TestClientMessagesHaveSchemas(t *testing.T) {
+	for _, m := range Messages {
+		if m.Direction != ClientToServer {
+			continue
+		}
+		if _, ok := clientMessages[m.Type]; !ok {
+			t.Errorf("client message %s has no schema", m.Type)
+		}
+		if schema := SchemaOf(m.Payload); schema["type"] != "object" {
+			t.Errorf("payload schema of %s has type %v, want object", m.Type, schema["type"])
+		}
+	}
+}